@@ -0,0 +1,451 @@
+package phi
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConflictError describes a route whose pattern conflicts with the pattern
+// of a route registered before it, so that the requests matching both are
+// served by only one of them.
+type ConflictError struct {
+	// Method lists the methods of both routes, "*" for all of them.
+	Method string
+
+	// Pattern is the routing pattern of the later route.
+	Pattern string
+
+	// Existing is the routing pattern of the earlier route.
+	Existing string
+
+	// Reason tells how the patterns conflict.
+	Reason string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("phi: %s '%s' conflicts with '%s', %s", e.Method, e.Pattern, e.Existing, e.Reason)
+}
+
+type conflictKind int
+
+const (
+	conflictNone      conflictKind = iota
+	conflictDuplicate              // the same pattern
+	conflictKeys                   // the same route with different param keys
+	conflictOverlap                // params with overlapping types or regexps
+	conflictShadowed               // a wildcard accepting all the values of a later one
+)
+
+var conflictReasons = map[conflictKind]string{
+	conflictDuplicate: "the route is already registered",
+	conflictKeys:      "the routes only differ in their param keys",
+	conflictOverlap:   "the values of their param types or regexps overlap",
+	conflictShadowed:  "its wildcard is shadowed by the existing one",
+}
+
+// Validate audits the routes of the Mux, along with those of its mounted
+// sub-routers and host routers, for conflicting and shadowed patterns.
+// Unlike the Strict mode, it doesn't panic and also reports the routes
+// replaced by a later registration of the same method.
+func (mx *Mux) Validate() []error {
+	return mx.validate("")
+}
+
+func (mx *Mux) validate(prefix string) []error {
+	var errs []error
+
+	pms := mx.root().patterns()
+	for i, pm := range pms {
+		for _, r := range pm.replaced {
+			kind := patConflict(pm.pattern, r.pattern)
+			if kind == conflictNone {
+				kind = conflictDuplicate
+			}
+			errs = append(errs, newConflictError(r.methods, prefix+pm.pattern, prefix+r.pattern, kind))
+		}
+		for _, prev := range pms[:i] {
+			if err := prev.conflict(pm.methods, pm.pattern); err != nil {
+				err.Pattern, err.Existing = prefix+err.Pattern, prefix+err.Existing
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	for _, rt := range mx.root().routes() {
+		if subMux, ok := rt.SubRoutes.(*Mux); ok {
+			errs = append(errs, subMux.validate(prefix+strings.TrimSuffix(rt.Pattern, "/*"))...)
+		}
+	}
+	for _, hr := range mx.hostRoutes() {
+		errs = append(errs, hr.mux.validate(prefix)...)
+	}
+	return errs
+}
+
+// findConflict returns the conflict of a new route with the routes of the
+// tree, if any. The patterns of the tree are indexed on first use, and the
+// index is kept up to date by addPattern.
+func (n *node) findConflict(method methodTyp, pattern string) *ConflictError {
+	method &^= mSTUB
+	if method == 0 {
+		return nil
+	}
+	if n.conflicts == nil {
+		n.conflicts = newPatternIndex(n.patterns())
+	}
+	return n.conflicts.conflict(method, pattern)
+}
+
+// addPattern adds the pattern of a new route to the index of the patterns
+// of the tree, if built.
+func (n *node) addPattern(method methodTyp, pattern string) {
+	method &^= mSTUB
+	if n.conflicts != nil && method != 0 {
+		n.conflicts.add(method, pattern)
+	}
+}
+
+// patternIndex indexes routing patterns by their shape, so that a new route
+// is only compared with those that may conflict with it.
+type patternIndex struct {
+	pms    []patternMethods
+	idx    map[string]int   // positions in pms by pattern
+	shapes map[string][]int // positions in pms by shape
+}
+
+func newPatternIndex(pms []patternMethods) *patternIndex {
+	x := &patternIndex{idx: make(map[string]int), shapes: make(map[string][]int)}
+	for _, pm := range pms {
+		x.add(pm.methods, pm.pattern)
+	}
+	return x
+}
+
+func (x *patternIndex) add(method methodTyp, pattern string) {
+	if i, ok := x.idx[pattern]; ok {
+		x.pms[i].methods |= method
+		return
+	}
+	i := len(x.pms)
+	x.idx[pattern] = i
+	x.pms = append(x.pms, patternMethods{pattern: pattern, methods: method})
+	for _, shape := range patShapes(pattern) {
+		x.shapes[shape] = append(x.shapes[shape], i)
+	}
+}
+
+// conflict returns the conflict of a new route with the earliest indexed
+// route it conflicts with, if any.
+func (x *patternIndex) conflict(method methodTyp, pattern string) *ConflictError {
+	var candidates []int
+	for _, shape := range patShapes(pattern) {
+		candidates = append(candidates, x.shapes[shape]...)
+	}
+	sort.Ints(candidates)
+	for j, i := range candidates {
+		if j > 0 && candidates[j-1] == i {
+			continue
+		}
+		if err := x.pms[i].conflict(method, pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patShapes returns the shapes of the expansions of a pattern: their static
+// text and the kinds of their params, which patConflict requires to be the
+// same for patterns to conflict.
+func patShapes(pattern string) []string {
+	var shapes []string
+	for _, rt := range patExpandOptional(pattern) {
+		var b strings.Builder
+		search := rt.pattern
+		for {
+			segTyp, _, _, _, ps, pe := patNextSegment(search)
+			if segTyp == ntStatic {
+				b.WriteString(search)
+				break
+			}
+			b.WriteString(search[:ps])
+			b.WriteByte(0)
+			b.WriteByte(byte(segTyp))
+			search = search[pe:]
+		}
+		shapes = append(shapes, b.String())
+	}
+	return shapes
+}
+
+// patternMethods is a routing pattern of the tree with the methods it
+// handles, and the patterns its endpoints replaced.
+type patternMethods struct {
+	pattern  string
+	methods  methodTyp
+	replaced []patternMethods
+}
+
+// patterns lists the patterns of the tree in walk order, which keeps the
+// patterns diverging at param nodes in order of registration.
+func (n *node) patterns() []patternMethods {
+	var pms []patternMethods
+	idx := make(map[string]int)
+
+	n.walk(func(eps endpoints, _ Routes) bool {
+		mts := make([]int, 0, len(eps))
+		for mt := range eps {
+			mts = append(mts, int(mt))
+		}
+		sort.Ints(mts)
+
+		for _, m := range mts {
+			mt := methodTyp(m)
+			h := eps[mt]
+			if mt == mSTUB || mt == mALL || h.handler == nil || h.pattern == "" {
+				continue
+			}
+			i, ok := idx[h.pattern]
+			if !ok {
+				i = len(pms)
+				idx[h.pattern] = i
+				pms = append(pms, patternMethods{pattern: h.pattern})
+			}
+			pms[i].methods |= mt
+			for _, r := range h.replaced {
+				pms[i].replaced = addPatternMethod(pms[i].replaced, r, mt)
+			}
+		}
+		return false
+	})
+	return pms
+}
+
+func addPatternMethod(pms []patternMethods, pattern string, method methodTyp) []patternMethods {
+	for i := range pms {
+		if pms[i].pattern == pattern {
+			pms[i].methods |= method
+			return pms
+		}
+	}
+	return append(pms, patternMethods{pattern: pattern, methods: method})
+}
+
+// conflict returns the conflict of a later route with the route of `pm`.
+// Patterns with optional params are compared by their expansions.
+func (pm patternMethods) conflict(method methodTyp, pattern string) *ConflictError {
+	methods := pm.methods & method
+	if methods == 0 {
+		return nil
+	}
+	if pattern == pm.pattern {
+		return newConflictError(methods, pattern, pm.pattern, conflictDuplicate)
+	}
+	for _, rt := range patExpandOptional(pattern) {
+		for _, xrt := range patExpandOptional(pm.pattern) {
+			if kind := patConflict(rt.pattern, xrt.pattern); kind != conflictNone {
+				return newConflictError(methods, pattern, pm.pattern, kind)
+			}
+		}
+	}
+	return nil
+}
+
+func newConflictError(methods methodTyp, pattern, existing string, kind conflictKind) *ConflictError {
+	return &ConflictError{
+		Method:   methodsString(methods),
+		Pattern:  pattern,
+		Existing: existing,
+		Reason:   conflictReasons[kind],
+	}
+}
+
+// methodsString lists the methods of a method set, "*" for all of them.
+func methodsString(methods methodTyp) string {
+	if methods&mALL == mALL {
+		return "*"
+	}
+	var ms []string
+	for m, mt := range methodMap {
+		if methods&mt != 0 {
+			ms = append(ms, m)
+		}
+	}
+	sort.Strings(ms)
+	return strings.Join(ms, ",")
+}
+
+// patConflict tells how a pattern conflicts with the pattern of an earlier
+// route. Patterns conflict when they have the same static text and the same
+// kinds of params in the same places, and the values of each pair of params
+// overlap. Other overlapping patterns are resolved by the routing precedence
+// of static text, regexp and typed params, params and wildcards.
+func patConflict(pattern, existing string) conflictKind {
+	if pattern == existing {
+		return conflictDuplicate
+	}
+
+	kind := conflictKeys
+	search, xsearch := pattern, existing
+	for {
+		segTyp, _, rexpat, _, ps, pe := patNextSegment(search)
+		xsegTyp, _, xrexpat, _, xps, xpe := patNextSegment(xsearch)
+
+		if segTyp != xsegTyp {
+			return conflictNone
+		}
+		if segTyp == ntStatic {
+			if search != xsearch {
+				return conflictNone
+			}
+			return kind
+		}
+		if search[:ps] != xsearch[:xps] {
+			return conflictNone
+		}
+
+		switch segTyp {
+		case ntRegexp:
+			if rexpat != xrexpat {
+				if !paramsOverlap(rexpat, xrexpat) {
+					return conflictNone
+				}
+				kind = conflictOverlap
+			}
+
+		case ntCatchAll:
+			// wildcards are tried in order of registration, so only an
+			// earlier one accepting all the values of this one shadows it
+			if rexpat != xrexpat {
+				if catchAllMin(xrexpat) > catchAllMin(rexpat) {
+					return conflictNone
+				}
+				kind = conflictShadowed
+			}
+		}
+
+		search, xsearch = search[pe:], xsearch[xpe:]
+	}
+}
+
+// catchAllMin returns the minimum number of path segments of a wildcard.
+func catchAllMin(rexpat string) int {
+	if rexpat == "" {
+		return 0
+	}
+	if min, err := strconv.Atoi(rexpat[1:]); err == nil {
+		return min
+	}
+	return 1
+}
+
+// paramsOverlap reports whether some value matches the types or regexps of
+// two params. It's conservative: params are only reported to overlap when
+// a sample value of either one matches the other.
+func paramsOverlap(rexpat, xrexpat string) bool {
+	match, _, err := paramMatcher(rexpat)
+	if err != nil {
+		return false
+	}
+	xmatch, _, err := paramMatcher(xrexpat)
+	if err != nil {
+		return false
+	}
+	if s, ok := paramSample(rexpat, match); ok && xmatch(s) {
+		return true
+	}
+	if s, ok := paramSample(xrexpat, xmatch); ok && match(s) {
+		return true
+	}
+	return false
+}
+
+// paramSamples are sample values of the builtin param types.
+var paramSamples = map[string]string{
+	"int":   "1",
+	"uint":  "1",
+	"alpha": "a",
+	"uuid":  "00000000-0000-0000-0000-000000000000",
+	"date":  "2000-01-01",
+}
+
+// paramSample returns a value matching the type or regexp of a param, if one
+// can be made up.
+func paramSample(rexpat string, match ParamMatcher) (string, bool) {
+	if s, ok := paramSamples[rexpat]; ok {
+		return s, match(s)
+	}
+	if _, ok := paramTypes[rexpat]; ok {
+		return "", false
+	}
+
+	re, err := syntax.Parse(rexpat, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	var b strings.Builder
+	if !writeSample(&b, re.Simplify()) {
+		return "", false
+	}
+	s := b.String()
+	if s == "" || strings.IndexByte(s, '/') >= 0 || !match(s) {
+		return "", false
+	}
+	return s, true
+}
+
+// writeSample writes the shortest string matched by a simplified regexp,
+// preferring the first alternatives and the first runes of char classes.
+func writeSample(b *strings.Builder, re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return false
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			b.WriteRune(r)
+		}
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			for r := re.Rune[i]; r <= re.Rune[i+1]; r++ {
+				if r > ' ' && r != '/' {
+					b.WriteRune(r)
+					return true
+				}
+				if r-re.Rune[i] > 0x80 {
+					break
+				}
+			}
+		}
+		return false
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteByte('a')
+	case syntax.OpCapture, syntax.OpPlus:
+		return writeSample(b, re.Sub[0])
+	case syntax.OpRepeat:
+		for i := 0; i < re.Min; i++ {
+			if !writeSample(b, re.Sub[0]) {
+				return false
+			}
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !writeSample(b, sub) {
+				return false
+			}
+		}
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			var sb strings.Builder
+			if writeSample(&sb, sub) {
+				b.WriteString(sb.String())
+				return true
+			}
+		}
+		return false
+	}
+	// empty matches, assertions, and the optional repeats of
+	// OpStar and OpQuest write nothing
+	return true
+}
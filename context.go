@@ -1,7 +1,11 @@
 package phi
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/valyala/fasthttp"
 )
@@ -43,6 +47,9 @@ type Context struct {
 
 	// methodNotAllowed hint
 	methodNotAllowed bool
+
+	// methods registered on the routes matched by path, but not by method
+	allowedMethodTyps methodTyp
 }
 
 // NewRouteContext returns a new routing Context object.
@@ -63,17 +70,100 @@ func (x *Context) Reset() {
 	x.routeParams.Keys = x.routeParams.Keys[:0]
 	x.routeParams.Values = x.routeParams.Values[:0]
 	x.methodNotAllowed = false
+	x.allowedMethodTyps = 0
+}
+
+// Clone returns a copy of the routing context, which shares no state with
+// it, for a handler to carry on routing in another goroutine.
+func (x *Context) Clone() *Context {
+	c := *x
+	c.RoutePatterns = append([]string(nil), x.RoutePatterns...)
+	c.URLParams.Keys = append([]string(nil), x.URLParams.Keys...)
+	c.URLParams.Values = append([]string(nil), x.URLParams.Values...)
+	c.routeParams.Keys = append([]string(nil), x.routeParams.Keys...)
+	c.routeParams.Values = append([]string(nil), x.routeParams.Values...)
+	return &c
 }
 
 // URLParam returns the corresponding URL parameter value from the request
 // routing context.
 func (x *Context) URLParam(key string) string {
+	value, _ := x.urlParam(key)
+	return value
+}
+
+// URLParamInt returns the corresponding URL parameter value parsed as an int,
+// or an error if the parameter is missing or not a valid int.
+func (x *Context) URLParamInt(key string) (int, error) {
+	value, err := x.requiredURLParam(key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+// URLParamInt64 returns the corresponding URL parameter value parsed as an int64,
+// or an error if the parameter is missing or not a valid int64.
+func (x *Context) URLParamInt64(key string) (int64, error) {
+	value, err := x.requiredURLParam(key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// URLParamUint64 returns the corresponding URL parameter value parsed as an uint64,
+// or an error if the parameter is missing or not a valid uint64.
+func (x *Context) URLParamUint64(key string) (uint64, error) {
+	value, err := x.requiredURLParam(key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// URLParamDate returns the corresponding URL parameter value parsed as a
+// YYYY-MM-DD date, or an error if the parameter is missing or not a valid date.
+func (x *Context) URLParamDate(key string) (time.Time, error) {
+	value, err := x.requiredURLParam(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func (x *Context) urlParam(key string) (string, bool) {
 	for k := len(x.URLParams.Keys) - 1; k >= 0; k-- {
 		if x.URLParams.Keys[k] == key {
-			return x.URLParams.Values[k]
+			return x.URLParams.Values[k], true
 		}
 	}
-	return ""
+	return "", false
+}
+
+func (x *Context) requiredURLParam(key string) (string, error) {
+	value, ok := x.urlParam(key)
+	if !ok {
+		return "", fmt.Errorf("phi: url param '%s' is missing", key)
+	}
+	return value, nil
+}
+
+// AllowedMethods returns the sorted list of http methods registered on
+// the route matching the request path when its method is not allowed,
+// as sent in the Allow header of 405 responses.
+func (x *Context) AllowedMethods() []string {
+	if x.allowedMethodTyps == 0 {
+		return nil
+	}
+	methods := make([]string, 0, len(methodMap))
+	for m, mt := range methodMap {
+		if x.allowedMethodTyps&mt == mt {
+			methods = append(methods, m)
+		}
+	}
+	sort.Strings(methods)
+	return methods
 }
 
 // RoutePattern builds the routing pattern string for the particular
@@ -109,6 +199,26 @@ func URLParam(ctx *fasthttp.RequestCtx, key string) string {
 	return ""
 }
 
+// URLParamInt returns the url parameter from *fasthttp.RequestCtx parsed as an int
+func URLParamInt(ctx *fasthttp.RequestCtx, key string) (int, error) {
+	return RouteContext(ctx).URLParamInt(key)
+}
+
+// URLParamInt64 returns the url parameter from *fasthttp.RequestCtx parsed as an int64
+func URLParamInt64(ctx *fasthttp.RequestCtx, key string) (int64, error) {
+	return RouteContext(ctx).URLParamInt64(key)
+}
+
+// URLParamUint64 returns the url parameter from *fasthttp.RequestCtx parsed as an uint64
+func URLParamUint64(ctx *fasthttp.RequestCtx, key string) (uint64, error) {
+	return RouteContext(ctx).URLParamUint64(key)
+}
+
+// URLParamDate returns the url parameter from *fasthttp.RequestCtx parsed as a YYYY-MM-DD date
+func URLParamDate(ctx *fasthttp.RequestCtx, key string) (time.Time, error) {
+	return RouteContext(ctx).URLParamDate(key)
+}
+
 // RouteParams is a structure to track URL routing parameters efficiently.
 type RouteParams struct {
 	Keys, Values []string
@@ -0,0 +1,77 @@
+package phi
+
+import (
+	"github.com/valyala/fasthttp"
+)
+
+// HTTPError is an error responded to with an HTTP status code by the
+// default error handler of a Mux, e.g.
+//
+//	r.MethodErr("GET", "/users/{id}", func(ctx *fasthttp.RequestCtx) error {
+//	  user, ok := users[phi.URLParam(ctx, "id")]
+//	  if !ok {
+//	    return phi.NewHTTPError(404, "user not found")
+//	  }
+//	  ...
+//	})
+type HTTPError struct {
+	// Status is the HTTP status code of the response.
+	Status int
+
+	// Message is the response body, the status text if empty.
+	Message string
+
+	// Err is the underlying error, if any. It's not written to the
+	// response by the default error handler.
+	Err error
+}
+
+// NewHTTPError returns an HTTPError with `status` and `message`.
+func NewHTTPError(status int, message string) *HTTPError {
+	return &HTTPError{Status: status, Message: message}
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return e.message() + ": " + e.Err.Error()
+	}
+	return e.message()
+}
+
+// StatusCode returns the HTTP status code of the error.
+func (e *HTTPError) StatusCode() int {
+	return e.Status
+}
+
+// Unwrap returns the underlying error.
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+func (e *HTTPError) message() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return fasthttp.StatusMessage(e.Status)
+}
+
+// handleError is the default error handler of a Mux. Errors with a status
+// code are responded to with their status and message, and any other error
+// with a 500. Unlike ctx.Error, it keeps the headers already set, like those
+// of the middlewares.
+func handleError(ctx *fasthttp.RequestCtx, err error) {
+	switch e := err.(type) {
+	case *HTTPError:
+		writeError(ctx, e.message(), e.Status)
+	case interface{ StatusCode() int }:
+		writeError(ctx, err.Error(), e.StatusCode())
+	default:
+		writeError(ctx, fasthttp.StatusMessage(fasthttp.StatusInternalServerError), fasthttp.StatusInternalServerError)
+	}
+}
+
+func writeError(ctx *fasthttp.RequestCtx, msg string, statusCode int) {
+	ctx.SetStatusCode(statusCode)
+	ctx.SetContentType("text/plain; charset=utf-8")
+	ctx.SetBodyString(msg)
+}
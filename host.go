@@ -0,0 +1,202 @@
+package phi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// hostRoute is a sub-router that serves requests whose host matches
+// its pattern, e.g. "api.example.com" or "{tenant:[a-z]+}.example.com".
+type hostRoute struct {
+	pattern  string
+	segments []hostSegment
+	mux      *Mux
+}
+
+// hostSegment is either a static piece of a host pattern, or a param
+// that captures a single host label.
+type hostSegment struct {
+	typ    nodeTyp
+	static string
+	key    string
+	match  ParamMatcher
+	tail   byte
+}
+
+// Host creates a new Mux with a fresh middleware stack that serves the
+// requests whose host matches `pattern`. Host patterns share the param
+// syntax of routing patterns, so "{sub}.example.com" and
+// "{tenant:[a-z]+}.api.example.com" capture the leading label into the
+// routing context URLParams. Static hosts are matched before patterns,
+// and requests matching no host fall back to the routes of this Mux.
+func (mx *Mux) Host(pattern string, fn func(r Router)) {
+	// Host routers hang off the non-inline mux, with any inline
+	// middlewares prepended to the fresh stack.
+	m := mx
+	for m.inline && m.parent != nil {
+		m = m.parent
+	}
+
+	subRouter := NewRouter()
+	m.inheritSettings(subRouter)
+	if mx.inline {
+		subRouter.Use(mx.middlewares...)
+	}
+	hr := newHostRoute(pattern, subRouter)
+	fn(subRouter)
+
+	// Assign the host router with the parent not found, method not allowed & error handler if not specified.
+	if subRouter.notFoundHandler == nil && m.notFoundHandler != nil {
+		subRouter.NotFound(m.notFoundHandler)
+	}
+	if subRouter.methodNotAllowedHandler == nil && m.methodNotAllowedHandler != nil {
+		subRouter.MethodNotAllowed(m.methodNotAllowedHandler)
+	}
+	if subRouter.errorHandler == nil && m.errorHandler != nil {
+		subRouter.ErrorHandler(m.errorHandler)
+	}
+
+	if !m.inline && m.handler == nil {
+		m.buildRouteHandler()
+	}
+
+	for _, h := range m.hosts {
+		if h.pattern == hr.pattern {
+			panic(fmt.Sprintf("phi: attempting to route an existing host pattern, '%s'", pattern))
+		}
+	}
+
+	// Keep static hosts ahead of the patterns, in order of registration.
+	// The hosts are copied, as those served may be read concurrently.
+	idx := len(m.hosts)
+	if hr.isStatic() {
+		for i, h := range m.hosts {
+			if !h.isStatic() {
+				idx = i
+				break
+			}
+		}
+	}
+	hosts := make([]*hostRoute, 0, len(m.hosts)+1)
+	hosts = append(hosts, m.hosts[:idx]...)
+	hosts = append(hosts, hr)
+	m.hosts = append(hosts, m.hosts[idx:]...)
+
+	// Within an update, the hosts are served once it's done
+	if m.tree == m.root() {
+		m.liveHosts.Store(m.hosts)
+	}
+}
+
+// routeHost returns the host router of `hosts` matching the request host,
+// recording the host params in the routing context.
+func routeHost(ctx *fasthttp.RequestCtx, rctx *Context, hosts []*hostRoute) *Mux {
+	host := requestHost(ctx)
+	for _, hr := range hosts {
+		if hr.match(host, &rctx.URLParams) {
+			return hr.mux
+		}
+	}
+	return nil
+}
+
+func newHostRoute(pattern string, mux *Mux) *hostRoute {
+	if pattern == "" {
+		panic("phi: host pattern must not be empty")
+	}
+	hr := &hostRoute{pattern: pattern, mux: mux}
+	patParamKeys(pattern) // sanity check for duplicate param keys
+	search := pattern
+
+	for len(search) > 0 {
+		segTyp, key, rexpat, tail, ps, pe := patNextSegment(search)
+		if segTyp == ntCatchAll {
+			panic(fmt.Sprintf("phi: wildcard '*' is not supported in host pattern '%s'", pattern))
+		}
+		if segTyp == ntStatic {
+			hr.segments = append(hr.segments, hostSegment{typ: ntStatic, static: strings.ToLower(search)})
+			break
+		}
+		if ps > 0 {
+			hr.segments = append(hr.segments, hostSegment{typ: ntStatic, static: strings.ToLower(search[:ps])})
+		}
+		if pe < len(search) && search[pe] == '{' {
+			panic(fmt.Sprintf("phi: adjacent params are not supported in host pattern '%s'", pattern))
+		}
+
+		if _, optional, _, _ := patParamSpec(key); optional {
+			panic(fmt.Sprintf("phi: optional params are not supported in host pattern '%s'", pattern))
+		}
+
+		seg := hostSegment{typ: segTyp, key: key, tail: tail}
+		if pe == len(search) {
+			seg.tail = 0
+		}
+		if segTyp == ntRegexp {
+			match, _, err := paramMatcher(rexpat)
+			if err != nil {
+				panic(fmt.Sprintf("phi: invalid regexp pattern '%s' in host param", rexpat))
+			}
+			seg.match = match
+		}
+		hr.segments = append(hr.segments, seg)
+		search = search[pe:]
+	}
+
+	return hr
+}
+
+func (hr *hostRoute) isStatic() bool {
+	return len(hr.segments) == 1 && hr.segments[0].typ == ntStatic
+}
+
+// match reports whether `host` matches the host pattern, appending the
+// captured params to `params` on success only.
+func (hr *hostRoute) match(host string, params *RouteParams) bool {
+	if hr.isStatic() {
+		return host == hr.segments[0].static
+	}
+
+	n := len(params.Keys)
+	search := host
+	for _, seg := range hr.segments {
+		if seg.typ == ntStatic {
+			if !strings.HasPrefix(search, seg.static) {
+				params.Keys, params.Values = params.Keys[:n], params.Values[:n]
+				return false
+			}
+			search = search[len(seg.static):]
+			continue
+		}
+
+		// a param captures a single host label, up to the tail delimiter
+		p := len(search)
+		if seg.tail != 0 {
+			p = strings.IndexByte(search, seg.tail)
+		}
+		if p <= 0 || strings.IndexByte(search[:p], '.') >= 0 ||
+			(seg.match != nil && !seg.match(search[:p])) {
+			params.Keys, params.Values = params.Keys[:n], params.Values[:n]
+			return false
+		}
+		params.Add(seg.key, search[:p])
+		search = search[p:]
+	}
+
+	if search != "" {
+		params.Keys, params.Values = params.Keys[:n], params.Values[:n]
+		return false
+	}
+	return true
+}
+
+// requestHost returns the lower-cased request host without the port.
+func requestHost(ctx *fasthttp.RequestCtx) string {
+	host := string(ctx.Host())
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && strings.IndexByte(host[i:], ']') < 0 {
+		host = host[:i]
+	}
+	return strings.ToLower(host)
+}
@@ -0,0 +1,20 @@
+package phi
+
+// RouteMeta is the metadata of a route, describing it to tools walking the
+// Routes of a Router, like docs generators.
+type RouteMeta map[string]interface{}
+
+// Meta sets the metadata `key` of the route to `value`. The metadata is
+// reported by Routes in Route.Meta, and isn't used for routing.
+//
+// For example,
+//
+//  r.Post("/items", h, phi.Meta("summary", "Creates an item"))
+func Meta(key string, value interface{}) RouteOption {
+	return func(e *endpoint) {
+		if e.meta == nil {
+			e.meta = RouteMeta{}
+		}
+		e.meta[key] = value
+	}
+}
@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// PrincipalKey is the user value key of the principal authenticated by
+	// the auth middlewares.
+	PrincipalKey = (&contextKey{"Principal"}).String()
+)
+
+var (
+	// ErrUnauthorized is the error wrapped by the *phi.HTTPError passed to
+	// the error handler of the Mux when a request isn't authenticated.
+	ErrUnauthorized = errors.New("phi: unauthorized")
+
+	// ErrForbidden is the error wrapped by the *phi.HTTPError passed to the
+	// error handler of the Mux when a request is authenticated but not
+	// allowed. Validators return it to respond with a 403 rather than a 401.
+	ErrForbidden = errors.New("phi: forbidden")
+)
+
+// GetPrincipal returns the principal authenticated by an auth middleware,
+// if any: the user name of BasicAuth, or the value returned by the
+// validator of BearerAuth and APIKeyAuth.
+func GetPrincipal(ctx *fasthttp.RequestCtx) interface{} {
+	return ctx.UserValue(PrincipalKey)
+}
+
+// TokenValidator validates a bearer token or an API key, and returns the
+// principal it authenticates. It returns ErrForbidden to respond with a 403,
+// and any other error to respond with a 401.
+type TokenValidator func(ctx *fasthttp.RequestCtx, token string) (principal interface{}, err error)
+
+// BasicAuth is a middleware authenticating the requests with HTTP Basic
+// credentials, checked against the user names and passwords of `creds` in
+// constant time. The user name is the principal of the request.
+func BasicAuth(realm string, creds map[string]string) phi.Middleware {
+	hashes := make(map[string][sha256.Size]byte, len(creds))
+	for user, pass := range creds {
+		hashes[user] = sha256.Sum256([]byte(pass))
+	}
+	return BasicAuthFunc(realm, func(ctx *fasthttp.RequestCtx, user, pass string) bool {
+		expected, ok := hashes[user]
+		// passwords are compared as hashes so the time taken doesn't
+		// depend on their length, nor on whether the user exists
+		h := sha256.Sum256([]byte(pass))
+		return subtle.ConstantTimeCompare(h[:], expected[:]) == 1 && ok
+	})
+}
+
+// BasicAuthFunc is a middleware authenticating the requests with HTTP Basic
+// credentials checked by `check`, which should compare them in constant
+// time. The user name is the principal of the request.
+//
+// The requests with no or invalid credentials are responded to with the
+// error handler of the Mux with a 401, challenging the client with the
+// Basic scheme in `realm`.
+func BasicAuthFunc(realm string, check func(ctx *fasthttp.RequestCtx, user, pass string) bool) phi.Middleware {
+	challenge := `Basic realm=` + quoteAuthParam(realm) + `, charset="UTF-8"`
+	return func(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+		return func(ctx *fasthttp.RequestCtx) {
+			user, pass, ok := basicAuth(ctx)
+			if !ok || !check(ctx, user, pass) {
+				unauthorized(ctx, challenge)
+				return
+			}
+			ctx.SetUserValue(PrincipalKey, user)
+			next(ctx)
+		}
+	}
+}
+
+// basicAuth returns the credentials of the Basic Authorization header.
+func basicAuth(ctx *fasthttp.RequestCtx) (user, pass string, ok bool) {
+	auth := ctx.Request.Header.Peek("Authorization")
+	const prefix = "basic "
+	if len(auth) < len(prefix) || !strings.EqualFold(string(auth[:len(prefix)]), prefix) {
+		return "", "", false
+	}
+	c, err := base64.StdEncoding.DecodeString(string(auth[len(prefix):]))
+	if err != nil {
+		return "", "", false
+	}
+	i := bytes.IndexByte(c, ':')
+	if i < 0 {
+		return "", "", false
+	}
+	return string(c[:i]), string(c[i+1:]), true
+}
+
+// BearerAuth is a middleware authenticating the requests with the bearer
+// token of their Authorization header, validated by `validate`.
+//
+// The requests with no or invalid tokens are responded to with the error
+// handler of the Mux with a 401, and the forbidden ones with a 403, both
+// challenging the client with the Bearer scheme in `realm` and the error
+// codes of RFC 6750.
+func BearerAuth(realm string, validate TokenValidator) phi.Middleware {
+	challenge := `Bearer realm=` + quoteAuthParam(realm)
+	return func(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+		return func(ctx *fasthttp.RequestCtx) {
+			token, ok := bearerToken(ctx)
+			if !ok {
+				unauthorized(ctx, challenge)
+				return
+			}
+			principal, err := validate(ctx, token)
+			if err == ErrForbidden {
+				forbidden(ctx, challenge+`, error="insufficient_scope"`)
+				return
+			}
+			if err != nil {
+				unauthorized(ctx, challenge+`, error="invalid_token"`)
+				return
+			}
+			ctx.SetUserValue(PrincipalKey, principal)
+			next(ctx)
+		}
+	}
+}
+
+// bearerToken returns the token of the Bearer Authorization header.
+func bearerToken(ctx *fasthttp.RequestCtx) (string, bool) {
+	auth := ctx.Request.Header.Peek("Authorization")
+	const prefix = "bearer "
+	if len(auth) <= len(prefix) || !strings.EqualFold(string(auth[:len(prefix)]), prefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(string(auth[len(prefix):]))
+	return token, token != ""
+}
+
+// APIKeyAuth is a middleware authenticating the requests with the API key
+// returned by `lookup`, e.g. KeyByHeader("X-Api-Key") or
+// KeyByQueryParam("api_key"), and validated by `validate`.
+//
+// The requests with no or invalid keys are responded to with the error
+// handler of the Mux with a 401, challenging the client with an ApiKey
+// scheme in `realm`, and the forbidden ones with a 403.
+func APIKeyAuth(realm string, lookup KeyFunc, validate TokenValidator) phi.Middleware {
+	challenge := `ApiKey realm=` + quoteAuthParam(realm)
+	return func(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+		return func(ctx *fasthttp.RequestCtx) {
+			key := lookup(ctx)
+			if key == "" {
+				unauthorized(ctx, challenge)
+				return
+			}
+			principal, err := validate(ctx, key)
+			if err == ErrForbidden {
+				forbidden(ctx, "")
+				return
+			}
+			if err != nil {
+				unauthorized(ctx, challenge)
+				return
+			}
+			ctx.SetUserValue(PrincipalKey, principal)
+			next(ctx)
+		}
+	}
+}
+
+func unauthorized(ctx *fasthttp.RequestCtx, challenge string) {
+	serveError(ctx, &phi.HTTPError{Status: fasthttp.StatusUnauthorized, Err: ErrUnauthorized})
+	ctx.Response.Header.Set("WWW-Authenticate", challenge)
+}
+
+func forbidden(ctx *fasthttp.RequestCtx, challenge string) {
+	serveError(ctx, &phi.HTTPError{Status: fasthttp.StatusForbidden, Err: ErrForbidden})
+	if challenge != "" {
+		ctx.Response.Header.Set("WWW-Authenticate", challenge)
+	}
+}
+
+// quoteAuthParam quotes the value of an auth-param, like a realm.
+func quoteAuthParam(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
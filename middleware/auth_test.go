@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+func TestBasicAuth(t *testing.T) {
+	r := phi.NewRouter()
+	r.Route("/admin", func(r phi.Router) {
+		r.Use(BasicAuth(`admin "area"`, map[string]string{"alice": "secret"}))
+		r.Get("/", func(ctx *fasthttp.RequestCtx) {
+			ctx.WriteString("hello " + GetPrincipal(ctx).(string))
+		})
+	})
+
+	tests := []struct {
+		auth   string
+		status int
+	}{
+		{"", 401},
+		{"Basic " + base64.StdEncoding.EncodeToString([]byte("alice:secret")), 200},
+		{"basic " + base64.StdEncoding.EncodeToString([]byte("alice:secret")), 200},
+		{"Basic " + base64.StdEncoding.EncodeToString([]byte("alice:wrong")), 401},
+		{"Basic " + base64.StdEncoding.EncodeToString([]byte("bob:secret")), 401},
+		{"Basic " + base64.StdEncoding.EncodeToString([]byte("alice")), 401},
+		{"Basic !!!", 401},
+		{"Bearer secret", 401},
+	}
+	for _, tt := range tests {
+		ctx := newRequestCtx("GET", "/admin")
+		if tt.auth != "" {
+			ctx.Request.Header.Set("Authorization", tt.auth)
+		}
+		r.Handler(ctx)
+		if ctx.Response.StatusCode() != tt.status {
+			t.Errorf("%q: expecting a %d, got:%d", tt.auth, tt.status, ctx.Response.StatusCode())
+		}
+		challenge := string(ctx.Response.Header.Peek("WWW-Authenticate"))
+		if tt.status == 401 && challenge != `Basic realm="admin \"area\"", charset="UTF-8"` {
+			t.Errorf("%q: unexpected challenge %s", tt.auth, challenge)
+		}
+		if tt.status == 200 && string(ctx.Response.Body()) != "hello alice" {
+			t.Errorf("%q: unexpected body %s", tt.auth, ctx.Response.Body())
+		}
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	r := phi.NewRouter()
+	r.ErrorHandler(func(ctx *fasthttp.RequestCtx, err error) {
+		e := err.(*phi.HTTPError)
+		ctx.Error(e.Err.Error(), e.Status)
+	})
+	r.Use(BearerAuth("api", func(ctx *fasthttp.RequestCtx, token string) (interface{}, error) {
+		switch token {
+		case "admin-token":
+			return "admin", nil
+		case "guest-token":
+			return nil, ErrForbidden
+		}
+		return nil, errors.New("unknown token")
+	}))
+	r.Get("/", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString(GetPrincipal(ctx).(string))
+	})
+
+	tests := []struct {
+		auth      string
+		status    int
+		body      string
+		challenge string
+	}{
+		{"", 401, "phi: unauthorized", `Bearer realm="api"`},
+		{"Bearer ", 401, "phi: unauthorized", `Bearer realm="api"`},
+		{"Bearer admin-token", 200, "admin", ""},
+		{"Bearer other", 401, "phi: unauthorized", `Bearer realm="api", error="invalid_token"`},
+		{"Bearer guest-token", 403, "phi: forbidden", `Bearer realm="api", error="insufficient_scope"`},
+	}
+	for _, tt := range tests {
+		ctx := newRequestCtx("GET", "/")
+		if tt.auth != "" {
+			ctx.Request.Header.Set("Authorization", tt.auth)
+		}
+		r.Handler(ctx)
+		if ctx.Response.StatusCode() != tt.status || string(ctx.Response.Body()) != tt.body ||
+			string(ctx.Response.Header.Peek("WWW-Authenticate")) != tt.challenge {
+			t.Errorf("%q: unexpected response %d %s\n%s", tt.auth, ctx.Response.StatusCode(), ctx.Response.Body(), ctx.Response.Header.String())
+		}
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	keys := map[string]string{"k1": "team-a", "k2": ""}
+	r := phi.NewRouter()
+	r.Use(APIKeyAuth("api", KeyByQueryParam("api_key"), func(ctx *fasthttp.RequestCtx, key string) (interface{}, error) {
+		team, ok := keys[key]
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		if team == "" {
+			return nil, ErrForbidden
+		}
+		return team, nil
+	}))
+	r.Get("/", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString(GetPrincipal(ctx).(string))
+	})
+
+	tests := []struct {
+		path      string
+		status    int
+		challenge string
+	}{
+		{"/", 401, `ApiKey realm="api"`},
+		{"/?api_key=k1", 200, ""},
+		{"/?api_key=k2", 403, ""},
+		{"/?api_key=k3", 401, `ApiKey realm="api"`},
+	}
+	for _, tt := range tests {
+		ctx := newRequestCtx("GET", tt.path)
+		r.Handler(ctx)
+		if ctx.Response.StatusCode() != tt.status || string(ctx.Response.Header.Peek("WWW-Authenticate")) != tt.challenge {
+			t.Errorf("%s: unexpected response %d\n%s", tt.path, ctx.Response.StatusCode(), ctx.Response.Header.String())
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// ErrBodyTooLarge is the error wrapped by the *phi.HTTPError passed to
+	// the error handler of the Mux when a request body is over the max size
+	// of its route.
+	ErrBodyTooLarge = errors.New("phi: request body too large")
+
+	// ErrUnsupportedMediaType is the error wrapped by the *phi.HTTPError
+	// passed to the error handler of the Mux when the content type of a
+	// request body isn't allowed on its route.
+	ErrUnsupportedMediaType = errors.New("phi: unsupported media type")
+)
+
+var (
+	// RequestBodyMetaKey is the route metadata key of the RequestBody set
+	// with RequestBody.Meta.
+	RequestBodyMetaKey = (&contextKey{"RequestBody"}).String()
+)
+
+// RequestBody restricts the request bodies of the routes registered with
+// the Router returned by its With method, reporting the restrictions in their
+// route metadata, so that e.g. the upload routes take bodies of up to 500 MB
+// while the JSON APIs take 1 MB at most:
+//
+//  upload := middleware.RequestBody{MaxSize: 500 << 20, ContentTypes: []string{"multipart/form-data"}}
+//  upload.With(r).Post("/upload", h)
+//
+// fasthttp reads the request bodies before calling the handlers, so the
+// MaxRequestBodySize of the fasthttp.Server must be the largest MaxSize of
+// its routes, the bodies over it being refused by the server itself.
+type RequestBody struct {
+	// MaxSize is the max size of the request bodies in bytes, no limit
+	// when 0. The larger bodies are responded to with a 413.
+	MaxSize int64
+
+	// ContentTypes are the media types allowed for the request bodies, like
+	// "application/json", or ending with a wildcard like "image/*". The
+	// bodies of other or no content types are responded to with a 415.
+	// Any content type is allowed when empty.
+	ContentTypes []string
+}
+
+// BodyLimit is a middleware responding to the requests with bodies over
+// `max` bytes with the error handler of the Mux with a 413.
+func BodyLimit(max int64) phi.Middleware {
+	return RequestBody{MaxSize: max}.Handler
+}
+
+// AllowContentType is a middleware responding to the requests with bodies
+// of content types other than `types` with the error handler of the Mux
+// with a 415. The types may end with a wildcard, like "image/*". Routes
+// panic on invalid types when registered.
+func AllowContentType(types ...string) phi.Middleware {
+	return RequestBody{ContentTypes: types}.Handler
+}
+
+// With returns r.With(b.Handler), whose routes are registered with the
+// b.Meta option. The routes of the Group, Route and Host sub-routers of the
+// returned Router are registered with it too.
+func (b RequestBody) With(r phi.Router) phi.Router {
+	return optionRouter{r.With(b.Handler), []phi.RouteOption{b.Meta()}}
+}
+
+// Meta is a route option reporting the restrictions of `b` in the route
+// metadata, under RequestBodyMetaKey. The With method registers the routes
+// with it.
+func (b RequestBody) Meta() phi.RouteOption {
+	return phi.Meta(RequestBodyMetaKey, b)
+}
+
+// Handler is the middleware restricting the request bodies. It panics on
+// invalid content types when applied, as routes are registered.
+func (b RequestBody) Handler(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+	types := make(map[string]struct{}, len(b.ContentTypes))
+	var wildcards []string
+	for _, t := range b.ContentTypes {
+		t = strings.ToLower(t)
+		if strings.Contains(strings.TrimSuffix(t, "/*"), "*") || strings.ContainsAny(t, "; ") {
+			panic(fmt.Sprintf("phi: invalid request body content-type '%s'", t))
+		}
+		if strings.HasSuffix(t, "/*") {
+			wildcards = append(wildcards, t[:len(t)-1])
+		} else {
+			types[t] = struct{}{}
+		}
+	}
+
+	allowed := func(contentType []byte) bool {
+		if i := bytes.IndexByte(contentType, ';'); i >= 0 {
+			contentType = contentType[:i]
+		}
+		t := strings.ToLower(string(bytes.TrimSpace(contentType)))
+		if _, ok := types[t]; ok {
+			return true
+		}
+		for _, w := range wildcards {
+			if strings.HasPrefix(t, w) && len(t) > len(w) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(ctx *fasthttp.RequestCtx) {
+		size := int64(len(ctx.Request.Body()))
+		if cl := int64(ctx.Request.Header.ContentLength()); cl > size {
+			size = cl
+		}
+		if b.MaxSize > 0 && size > b.MaxSize {
+			serveError(ctx, &phi.HTTPError{Status: fasthttp.StatusRequestEntityTooLarge, Err: ErrBodyTooLarge})
+			return
+		}
+		if len(b.ContentTypes) > 0 && size > 0 && !allowed(ctx.Request.Header.ContentType()) {
+			serveError(ctx, &phi.HTTPError{Status: fasthttp.StatusUnsupportedMediaType, Err: ErrUnsupportedMediaType})
+			return
+		}
+		next(ctx)
+	}
+}
+
+// optionRouter is a Router registering its routes with route options.
+type optionRouter struct {
+	phi.Router
+	opts []phi.RouteOption
+}
+
+func (r optionRouter) with(opts []phi.RouteOption) []phi.RouteOption {
+	return append(opts[:len(opts):len(opts)], r.opts...)
+}
+
+func (r optionRouter) wrap(fn func(r phi.Router)) func(r phi.Router) {
+	return func(sr phi.Router) {
+		fn(optionRouter{sr, r.opts})
+	}
+}
+
+func (r optionRouter) With(middlewares ...phi.Middleware) phi.Router {
+	return optionRouter{r.Router.With(middlewares...), r.opts}
+}
+
+func (r optionRouter) Group(fn func(r phi.Router)) {
+	r.Router.Group(r.wrap(fn))
+}
+
+func (r optionRouter) Route(pattern string, fn func(r phi.Router)) {
+	r.Router.Route(pattern, r.wrap(fn))
+}
+
+func (r optionRouter) Host(pattern string, fn func(r phi.Router)) {
+	r.Router.Host(pattern, r.wrap(fn))
+}
+
+func (r optionRouter) Handle(pattern string, h phi.RequestHandlerFunc, opts ...phi.RouteOption) {
+	r.Router.Handle(pattern, h, r.with(opts)...)
+}
+
+func (r optionRouter) Method(method, pattern string, h phi.RequestHandlerFunc, opts ...phi.RouteOption) {
+	r.Router.Method(method, pattern, h, r.with(opts)...)
+}
+
+func (r optionRouter) HandleErr(pattern string, h phi.ErrorHandlerFunc, opts ...phi.RouteOption) {
+	r.Router.HandleErr(pattern, h, r.with(opts)...)
+}
+
+func (r optionRouter) MethodErr(method, pattern string, h phi.ErrorHandlerFunc, opts ...phi.RouteOption) {
+	r.Router.MethodErr(method, pattern, h, r.with(opts)...)
+}
+
+func (r optionRouter) Connect(pattern string, h phi.RequestHandlerFunc, opts ...phi.RouteOption) {
+	r.Router.Connect(pattern, h, r.with(opts)...)
+}
+
+func (r optionRouter) Delete(pattern string, h phi.RequestHandlerFunc, opts ...phi.RouteOption) {
+	r.Router.Delete(pattern, h, r.with(opts)...)
+}
+
+func (r optionRouter) Get(pattern string, h phi.RequestHandlerFunc, opts ...phi.RouteOption) {
+	r.Router.Get(pattern, h, r.with(opts)...)
+}
+
+func (r optionRouter) Head(pattern string, h phi.RequestHandlerFunc, opts ...phi.RouteOption) {
+	r.Router.Head(pattern, h, r.with(opts)...)
+}
+
+func (r optionRouter) Options(pattern string, h phi.RequestHandlerFunc, opts ...phi.RouteOption) {
+	r.Router.Options(pattern, h, r.with(opts)...)
+}
+
+func (r optionRouter) Patch(pattern string, h phi.RequestHandlerFunc, opts ...phi.RouteOption) {
+	r.Router.Patch(pattern, h, r.with(opts)...)
+}
+
+func (r optionRouter) Post(pattern string, h phi.RequestHandlerFunc, opts ...phi.RouteOption) {
+	r.Router.Post(pattern, h, r.with(opts)...)
+}
+
+func (r optionRouter) Put(pattern string, h phi.RequestHandlerFunc, opts ...phi.RouteOption) {
+	r.Router.Put(pattern, h, r.with(opts)...)
+}
+
+func (r optionRouter) Trace(pattern string, h phi.RequestHandlerFunc, opts ...phi.RouteOption) {
+	r.Router.Trace(pattern, h, r.with(opts)...)
+}
@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+func TestRequestBody(t *testing.T) {
+	upload := RequestBody{MaxSize: 64, ContentTypes: []string{"multipart/form-data", "image/*"}}
+
+	r := phi.NewRouter()
+	upload.With(r).Post("/upload", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("uploaded")
+	})
+	r.With(BodyLimit(8), AllowContentType("application/json")).Post("/items", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("created")
+	})
+	r.Post("/any", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("ok")
+	})
+
+	tests := []struct {
+		path, contentType, body string
+		status                  int
+	}{
+		{"/upload", "multipart/form-data; boundary=x", "parts", 200},
+		{"/upload", "Image/PNG", "png", 200},
+		{"/upload", "image/", "png", 415},
+		{"/upload", "application/json", "{}", 415},
+		{"/upload", "", "data", 415},
+		{"/upload", "image/png", string(make([]byte, 65)), 413},
+		{"/items", "application/json", "{}", 200},
+		{"/items", "application/json", "", 200},
+		{"/items", "text/plain", "", 200},
+		{"/items", "application/json", `{"a":"b"}`, 413},
+		{"/items", "text/plain", "{}", 415},
+		{"/any", "text/plain", string(make([]byte, 1024)), 200},
+	}
+	for _, tt := range tests {
+		ctx := newRequestCtx("POST", tt.path)
+		if tt.contentType != "" {
+			ctx.Request.Header.SetContentType(tt.contentType)
+		}
+		ctx.Request.SetBodyString(tt.body)
+		r.Handler(ctx)
+		if status := ctx.Response.StatusCode(); status != tt.status {
+			t.Errorf("%s %q %d bytes: expecting %d, got:%d %s", tt.path, tt.contentType, len(tt.body), tt.status, status, ctx.Response.Body())
+		}
+	}
+
+	// the declared length is checked before the body
+	ctx := newRequestCtx("POST", "/items")
+	ctx.Request.Header.SetContentType("application/json")
+	ctx.Request.Header.SetContentLength(1 << 20)
+	r.Handler(ctx)
+	if ctx.Response.StatusCode() != 413 {
+		t.Errorf("expecting 413, got:%d", ctx.Response.StatusCode())
+	}
+
+	var meta interface{}
+	for _, rt := range r.Routes() {
+		if rt.Pattern == "/upload" {
+			meta = rt.Meta["POST"][RequestBodyMetaKey]
+		}
+	}
+	if b, ok := meta.(RequestBody); !ok || b.MaxSize != 64 || len(b.ContentTypes) != 2 {
+		t.Errorf("expecting the request body in the route metadata, got:%v", meta)
+	}
+}
+
+func TestRequestBodyWith(t *testing.T) {
+	jsonBody := RequestBody{MaxSize: 8, ContentTypes: []string{"application/json"}}
+	h := func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("ok")
+	}
+
+	r := phi.NewRouter()
+	api := jsonBody.With(r)
+	api.Put("/items/{id}", h, phi.Name("item"))
+	api.With(RequestID).Post("/items", h)
+	api.Group(func(r phi.Router) {
+		r.Patch("/items/{id}", h)
+	})
+	api.Route("/orders", func(r phi.Router) {
+		r.Post("/", h)
+	})
+	r.Get("/items", h)
+
+	// the routes of the returned Router are restricted
+	for _, rt := range []struct{ method, path string }{
+		{"PUT", "/items/1"}, {"POST", "/items"}, {"PATCH", "/items/1"}, {"POST", "/orders"},
+	} {
+		ctx := newRequestCtx(rt.method, rt.path)
+		ctx.Request.Header.SetContentType("text/plain")
+		ctx.Request.SetBodyString("{}")
+		r.Handler(ctx)
+		if ctx.Response.StatusCode() != 415 {
+			t.Errorf("%s %s: expecting 415, got:%d", rt.method, rt.path, ctx.Response.StatusCode())
+		}
+	}
+
+	// and report it in their metadata, along with their own options
+	meta := map[string]interface{}{}
+	var walk func(prefix string, routes phi.Routes)
+	walk = func(prefix string, routes phi.Routes) {
+		for _, rt := range routes.Routes() {
+			if rt.SubRoutes != nil {
+				walk(prefix+strings.TrimSuffix(rt.Pattern, "/*"), rt.SubRoutes)
+				continue
+			}
+			for m := range rt.Handlers {
+				meta[m+" "+prefix+rt.Pattern] = rt.Meta[m][RequestBodyMetaKey]
+			}
+		}
+	}
+	walk("", r)
+	for _, route := range []string{"PUT /items/{id}", "POST /items", "PATCH /items/{id}", "POST /orders/"} {
+		if b, ok := meta[route].(RequestBody); !ok || b.MaxSize != 8 {
+			t.Errorf("%s: expecting the request body in the route metadata, got:%v", route, meta[route])
+		}
+	}
+	if meta["GET /items"] != nil {
+		t.Errorf("expecting no request body in the metadata of other routes, got:%v", meta["GET /items"])
+	}
+	if u, err := r.URL("item", "id", "1"); err != nil || u != "/items/1" {
+		t.Errorf("expecting the route options to be kept, got:%s %v", u, err)
+	}
+}
+
+func TestRequestBodyErrorHandler(t *testing.T) {
+	var errs []error
+	r := phi.NewRouter()
+	r.ErrorHandler(func(ctx *fasthttp.RequestCtx, err error) {
+		errs = append(errs, err.(*phi.HTTPError).Err)
+		ctx.SetStatusCode(err.(*phi.HTTPError).Status)
+	})
+	r.With(BodyLimit(1), AllowContentType("text/plain")).Put("/", func(ctx *fasthttp.RequestCtx) {})
+
+	for _, body := range []string{"ab", "a"} {
+		ctx := newRequestCtx("PUT", "/")
+		ctx.Request.Header.SetContentType("application/json")
+		ctx.Request.SetBodyString(body)
+		r.Handler(ctx)
+	}
+	if len(errs) != 2 || errs[0] != ErrBodyTooLarge || errs[1] != ErrUnsupportedMediaType {
+		t.Errorf("expecting the body errors, got:%v", errs)
+	}
+}
+
+func TestRequestBodyInvalidType(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expecting a panic")
+		}
+	}()
+	r := phi.NewRouter()
+	r.With(AllowContentType("application/*+json")).Post("/", func(ctx *fasthttp.RequestCtx) {})
+	t.Errorf("expecting a panic")
+}
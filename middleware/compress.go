@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+// defaultCompressibleContentTypes are the content types compressed when
+// none are given.
+var defaultCompressibleContentTypes = []string{
+	"text/html",
+	"text/css",
+	"text/plain",
+	"text/javascript",
+	"application/javascript",
+	"application/x-javascript",
+	"application/json",
+	"application/atom+xml",
+	"application/rss+xml",
+	"image/svg+xml",
+}
+
+// defaultCompressMinSize is the default minimum size of the bodies
+// compressed, below which compression rarely pays off.
+const defaultCompressMinSize = 512
+
+// Compress is a middleware that compresses the response bodies of the given
+// content types, or of the common text types if none are given, with the
+// encodings accepted by the clients. `level` is a compress/flate level,
+// like flate.DefaultCompression.
+//
+// Like every middleware, it can be applied to a group of routes only with
+// Router.With or Router.Group.
+func Compress(level int, types ...string) phi.Middleware {
+	return NewCompressor(level, types...).Handler
+}
+
+// EncoderFunc appends the encoding of `src` at a compress/flate level to
+// `dst`.
+type EncoderFunc func(dst, src []byte, level int) []byte
+
+// Compressor compresses the response bodies with the gzip or deflate
+// encoding, and the encodings set with SetEncoder.
+//
+// Brotli and zstd have no encoder in the standard library; they may be
+// provided with SetEncoder.
+type Compressor struct {
+	level        int
+	minSize      int
+	types        map[string]struct{}
+	wildcards    []string
+	encoders     map[string]EncoderFunc
+	encodingPrec []string
+	pool         sync.Pool
+}
+
+// NewCompressor returns a Compressor of the given content types, or of the
+// common text types if none are given, at a compress/flate level. Types may
+// end with a wildcard, like "text/*". It panics on invalid types or levels.
+func NewCompressor(level int, types ...string) *Compressor {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		panic(fmt.Sprintf("phi: invalid compression level %d", level))
+	}
+	if len(types) == 0 {
+		types = defaultCompressibleContentTypes
+	}
+
+	c := &Compressor{
+		level:   level,
+		minSize: defaultCompressMinSize,
+		types:   make(map[string]struct{}),
+	}
+	for _, t := range types {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if strings.Contains(strings.TrimSuffix(t, "/*"), "*") {
+			panic(fmt.Sprintf("phi: unsupported content-type wildcard pattern '%s'", t))
+		}
+		if strings.HasSuffix(t, "/*") {
+			c.wildcards = append(c.wildcards, t[:len(t)-1])
+		} else {
+			c.types[t] = struct{}{}
+		}
+	}
+
+	c.SetEncoder("deflate", fasthttp.AppendDeflateBytesLevel)
+	c.SetEncoder("gzip", fasthttp.AppendGzipBytesLevel)
+	c.pool.New = func() interface{} {
+		return &compressBuffer{}
+	}
+	return c
+}
+
+// SetEncoder sets the encoder of an encoding, preferred over the encodings
+// set before it when the client accepts them equally.
+func (c *Compressor) SetEncoder(encoding string, fn EncoderFunc) {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "" {
+		panic("phi: the encoding must not be empty")
+	}
+	if fn == nil {
+		panic("phi: the encoder must not be nil")
+	}
+	if c.encoders == nil {
+		c.encoders = make(map[string]EncoderFunc)
+	}
+
+	for i, e := range c.encodingPrec {
+		if e == encoding {
+			c.encodingPrec = append(c.encodingPrec[:i], c.encodingPrec[i+1:]...)
+			break
+		}
+	}
+	c.encoders[encoding] = fn
+	c.encodingPrec = append([]string{encoding}, c.encodingPrec...)
+}
+
+// SetMinSize sets the minimum size of the bodies compressed, 512 bytes by
+// default.
+func (c *Compressor) SetMinSize(size int) {
+	c.minSize = size
+}
+
+type compressBuffer struct {
+	b []byte
+}
+
+// Handler returns the compression middleware.
+func (c *Compressor) Handler(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+	return func(ctx *fasthttp.RequestCtx) {
+		next(ctx)
+
+		resp := &ctx.Response
+		if !c.compressible(resp.Header.ContentType()) {
+			return
+		}
+		resp.Header.Add("Vary", "Accept-Encoding")
+
+		status := resp.StatusCode()
+		if status < 200 || status == fasthttp.StatusNoContent || status == fasthttp.StatusNotModified ||
+			ctx.IsHead() || resp.IsBodyStream() || len(resp.Header.Peek("Content-Encoding")) > 0 {
+			return
+		}
+		body := resp.Body()
+		if len(body) < c.minSize {
+			return
+		}
+		encoding := c.negotiate(ctx.Request.Header.Peek("Accept-Encoding"))
+		if encoding == "" {
+			return
+		}
+
+		cb := c.pool.Get().(*compressBuffer)
+		cb.b = c.encoders[encoding](cb.b[:0], body, c.level)
+		resp.SetBody(cb.b)
+		c.pool.Put(cb)
+		resp.Header.Set("Content-Encoding", encoding)
+	}
+}
+
+// compressible reports whether responses of a content type are compressed.
+func (c *Compressor) compressible(contentType []byte) bool {
+	if i := bytes.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	t := strings.ToLower(string(bytes.TrimSpace(contentType)))
+	if _, ok := c.types[t]; ok {
+		return true
+	}
+	for _, w := range c.wildcards {
+		if strings.HasPrefix(t, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate returns the preferred encoding of those accepted by the
+// Accept-Encoding header, or an empty string.
+func (c *Compressor) negotiate(accept []byte) string {
+	if len(accept) == 0 {
+		return ""
+	}
+
+	var best string
+	var bestQ float64
+	anyQ := -1.0
+	accepted := make(map[string]float64, 4)
+	for _, part := range strings.Split(string(accept), ",") {
+		enc, q := parseAcceptEncoding(part)
+		if enc == "*" {
+			anyQ = q
+			continue
+		}
+		accepted[enc] = q
+	}
+
+	for _, enc := range c.encodingPrec {
+		q, ok := accepted[enc]
+		if !ok {
+			q = anyQ
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// parseAcceptEncoding parses an element of an Accept-Encoding header, like
+// "gzip;q=0.8".
+func parseAcceptEncoding(s string) (string, float64) {
+	q := 1.0
+	enc := s
+	if i := strings.IndexByte(s, ';'); i >= 0 {
+		enc = s[:i]
+		param := strings.TrimSpace(s[i+1:])
+		if strings.HasPrefix(param, "q=") {
+			if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+				q = v
+			}
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(enc)), q
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat("hello world ", 100)
+
+	r := phi.NewRouter()
+	r.Get("/plain", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString(body)
+	})
+	r.Group(func(r phi.Router) {
+		r.Use(Compress(flate.DefaultCompression, "text/*", "application/json"))
+		r.Get("/text", func(ctx *fasthttp.RequestCtx) {
+			ctx.SetContentType("text/plain; charset=utf-8")
+			ctx.WriteString(body)
+		})
+		r.Get("/small", func(ctx *fasthttp.RequestCtx) {
+			ctx.SetContentType("application/json")
+			ctx.WriteString(`{"ok":true}`)
+		})
+		r.Get("/image", func(ctx *fasthttp.RequestCtx) {
+			ctx.SetContentType("image/png")
+			ctx.WriteString(body)
+		})
+		r.Get("/encoded", func(ctx *fasthttp.RequestCtx) {
+			ctx.SetContentType("text/plain")
+			ctx.Response.Header.Set("Content-Encoding", "gzip")
+			ctx.Write(fasthttp.AppendGzipBytes(nil, []byte(body)))
+		})
+	})
+	r.With(Compress(flate.BestSpeed)).Get("/with", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetContentType("text/html")
+		ctx.WriteString(body)
+	})
+
+	tests := []struct {
+		path, accept string
+		encoding     string
+		vary         bool
+	}{
+		{"/plain", "gzip", "", false},
+		{"/text", "", "", true},
+		{"/text", "gzip, deflate", "gzip", true},
+		{"/text", "deflate", "deflate", true},
+		{"/text", "gzip;q=0.5, deflate", "deflate", true},
+		{"/text", "gzip;q=0, *", "deflate", true},
+		{"/text", "br", "", true},
+		{"/small", "gzip", "", true},
+		{"/image", "gzip", "", false},
+		{"/encoded", "deflate", "gzip", true},
+		{"/with", "gzip", "gzip", true},
+	}
+	for _, tt := range tests {
+		ctx := newRequestCtx("GET", tt.path)
+		ctx.Request.Header.Set("Accept-Encoding", tt.accept)
+		r.Handler(ctx)
+
+		h := &ctx.Response.Header
+		if encoding := string(h.Peek("Content-Encoding")); encoding != tt.encoding {
+			t.Errorf("%s %q: expecting encoding %q, got:%q", tt.path, tt.accept, tt.encoding, encoding)
+			continue
+		}
+		if vary := string(h.Peek("Vary")) == "Accept-Encoding"; vary != tt.vary {
+			t.Errorf("%s %q: expecting vary %v", tt.path, tt.accept, tt.vary)
+		}
+
+		got := ctx.Response.Body()
+		switch tt.encoding {
+		case "gzip":
+			zr, err := gzip.NewReader(bytes.NewReader(got))
+			if err != nil {
+				t.Fatalf("%s: %v", tt.path, err)
+			}
+			got, _ = ioutil.ReadAll(zr)
+		case "deflate":
+			zr, err := zlib.NewReader(bytes.NewReader(got))
+			if err != nil {
+				t.Fatalf("%s: %v", tt.path, err)
+			}
+			got, _ = ioutil.ReadAll(zr)
+		}
+		if tt.path != "/small" && string(got) != body {
+			t.Errorf("%s %q: unexpected body %q", tt.path, tt.accept, got)
+		}
+	}
+}
+
+func TestCompressorSetEncoder(t *testing.T) {
+	c := NewCompressor(flate.DefaultCompression)
+	c.SetMinSize(0)
+	c.SetEncoder("rot", func(dst, src []byte, level int) []byte {
+		return append(dst, bytes.ToUpper(src)...)
+	})
+
+	r := phi.NewRouter()
+	r.Use(c.Handler)
+	r.Get("/", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetContentType("text/plain")
+		ctx.WriteString("hi")
+	})
+
+	ctx := newRequestCtx("GET", "/")
+	ctx.Request.Header.Set("Accept-Encoding", "gzip, rot")
+	r.Handler(ctx)
+	if string(ctx.Response.Header.Peek("Content-Encoding")) != "rot" || string(ctx.Response.Body()) != "HI" {
+		t.Errorf("expecting the custom encoder to be preferred, got:%s", ctx.Response.Header.String())
+	}
+}
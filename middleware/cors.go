@@ -0,0 +1,298 @@
+package middleware
+
+import (
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+// CORSOptions configures the CORS middleware.
+type CORSOptions struct {
+	// AllowedOrigins lists the origins allowed to make cross-origin
+	// requests, like "https://example.com". An origin may hold a single
+	// wildcard for the subdomains of a domain, like "https://*.example.com",
+	// and "*" allows all origins.
+	AllowedOrigins []string
+
+	// AllowedOriginRegexps lists regexps matching the allowed origins.
+	AllowedOriginRegexps []*regexp.Regexp
+
+	// AllowOriginFunc is called with the origins not allowed by the
+	// options above, to allow them as well.
+	AllowOriginFunc func(ctx *fasthttp.RequestCtx, origin string) bool
+
+	// AllowedMethods lists the methods allowed for cross-origin requests,
+	// GET, HEAD and POST by default.
+	AllowedMethods []string
+
+	// AllowedHeaders lists the request headers allowed for cross-origin
+	// requests, "*" for all of them. Accept, Content-Type and
+	// X-Requested-With are allowed by default.
+	AllowedHeaders []string
+
+	// ExposedHeaders lists the response headers exposed to the clients.
+	ExposedHeaders []string
+
+	// AllowCredentials allows the requests with credentials, like cookies.
+	AllowCredentials bool
+
+	// MaxAge is the number of seconds the preflight responses may be
+	// cached for, not sent if zero.
+	MaxAge int
+
+	// RouteMethods advertises only the allowed methods served on the path
+	// of the preflight requests, as listed by phi.Mux.AllowedMethods in the
+	// Allow header, or found with phi.Routes.Match for other Routes. The
+	// preflight requests of paths with no such method are routed as usual.
+	// Host routers aren't searched.
+	RouteMethods bool
+}
+
+// CORS returns a middleware handling the cross-origin requests, which
+// answers the preflight OPTIONS requests itself. It should be used on the
+// Mux rather than on a route, for the preflight requests to reach it.
+func CORS(opts CORSOptions) phi.Middleware {
+	c := newCORS(opts)
+	return func(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+		return func(ctx *fasthttp.RequestCtx) {
+			if ctx.IsOptions() && len(ctx.Request.Header.Peek("Access-Control-Request-Method")) > 0 {
+				c.preflight(ctx, next)
+				return
+			}
+			c.actual(ctx)
+			next(ctx)
+		}
+	}
+}
+
+type cors struct {
+	allOrigins      bool
+	origins         []string
+	wildcardOrigins [][2]string
+	originRegexps   []*regexp.Regexp
+	originFunc      func(ctx *fasthttp.RequestCtx, origin string) bool
+
+	methods    []string
+	allHeaders bool
+	headers    []string
+
+	allowMethods  string
+	exposeHeaders string
+	credentials   bool
+	maxAge        string
+	routeMethods  bool
+}
+
+func newCORS(opts CORSOptions) *cors {
+	c := &cors{
+		originRegexps: opts.AllowedOriginRegexps,
+		originFunc:    opts.AllowOriginFunc,
+		credentials:   opts.AllowCredentials,
+		routeMethods:  opts.RouteMethods,
+	}
+
+	for _, origin := range opts.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		if origin == "*" {
+			c.allOrigins = true
+		} else if i := strings.IndexByte(origin, '*'); i >= 0 {
+			c.wildcardOrigins = append(c.wildcardOrigins, [2]string{origin[:i], origin[i+1:]})
+		} else {
+			c.origins = append(c.origins, origin)
+		}
+	}
+
+	methods := opts.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{"GET", "HEAD", "POST"}
+	}
+	for _, m := range methods {
+		c.methods = append(c.methods, strings.ToUpper(m))
+	}
+	c.allowMethods = strings.Join(c.methods, ", ")
+
+	headers := opts.AllowedHeaders
+	if len(headers) == 0 {
+		headers = []string{"Accept", "Content-Type", "X-Requested-With"}
+	}
+	for _, h := range headers {
+		if h == "*" {
+			c.allHeaders = true
+			continue
+		}
+		c.headers = append(c.headers, textproto.CanonicalMIMEHeaderKey(h))
+	}
+
+	c.exposeHeaders = strings.Join(opts.ExposedHeaders, ", ")
+	if opts.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(opts.MaxAge)
+	}
+	return c
+}
+
+// preflight answers a preflight request, or routes it when RouteMethods
+// finds no method registered for its path.
+func (c *cors) preflight(ctx *fasthttp.RequestCtx, next phi.RequestHandlerFunc) {
+	h := &ctx.Response.Header
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	allowMethods := c.allowMethods
+	if c.routeMethods {
+		allowMethods = c.matchMethods(ctx)
+		if allowMethods == "" {
+			next(ctx)
+			return
+		}
+	}
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+
+	origin := string(ctx.Request.Header.Peek("Origin"))
+	if origin == "" || !c.allowOrigin(ctx, origin) {
+		return
+	}
+	method := strings.ToUpper(string(ctx.Request.Header.Peek("Access-Control-Request-Method")))
+	if !containsToken(allowMethods, method) {
+		return
+	}
+	reqHeaders, ok := c.allowHeaders(string(ctx.Request.Header.Peek("Access-Control-Request-Headers")))
+	if !ok {
+		return
+	}
+
+	c.setOrigin(ctx, origin)
+	h.Set("Access-Control-Allow-Methods", allowMethods)
+	if reqHeaders != "" {
+		h.Set("Access-Control-Allow-Headers", reqHeaders)
+	}
+	if c.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if c.maxAge != "" {
+		h.Set("Access-Control-Max-Age", c.maxAge)
+	}
+}
+
+// actual sets the CORS headers of an actual cross-origin request.
+func (c *cors) actual(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Add("Vary", "Origin")
+
+	origin := string(ctx.Request.Header.Peek("Origin"))
+	if origin == "" || !c.allowOrigin(ctx, origin) {
+		return
+	}
+	if !containsString(c.methods, string(ctx.Method())) {
+		return
+	}
+
+	c.setOrigin(ctx, origin)
+	if c.credentials {
+		ctx.Response.Header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if c.exposeHeaders != "" {
+		ctx.Response.Header.Set("Access-Control-Expose-Headers", c.exposeHeaders)
+	}
+}
+
+func (c *cors) setOrigin(ctx *fasthttp.RequestCtx, origin string) {
+	if c.allOrigins && !c.credentials {
+		origin = "*"
+	}
+	ctx.Response.Header.Set("Access-Control-Allow-Origin", origin)
+}
+
+func (c *cors) allowOrigin(ctx *fasthttp.RequestCtx, origin string) bool {
+	if c.allOrigins {
+		return true
+	}
+	o := strings.ToLower(origin)
+	for _, allowed := range c.origins {
+		if o == allowed {
+			return true
+		}
+	}
+	for _, w := range c.wildcardOrigins {
+		if len(o) > len(w[0])+len(w[1]) && strings.HasPrefix(o, w[0]) && strings.HasSuffix(o, w[1]) {
+			return true
+		}
+	}
+	for _, re := range c.originRegexps {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return c.originFunc != nil && c.originFunc(ctx, origin)
+}
+
+// allowHeaders returns the request headers of a preflight request in
+// canonical form, if they're all allowed.
+func (c *cors) allowHeaders(reqHeaders string) (string, bool) {
+	if strings.TrimSpace(reqHeaders) == "" {
+		return "", true
+	}
+	var allowed []string
+	for _, h := range strings.Split(reqHeaders, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		h = textproto.CanonicalMIMEHeaderKey(h)
+		if !c.allHeaders && !containsString(c.headers, h) {
+			return "", false
+		}
+		allowed = append(allowed, h)
+	}
+	return strings.Join(allowed, ", "), true
+}
+
+// matchMethods lists the allowed methods served on the path of the request.
+func (c *cors) matchMethods(ctx *fasthttp.RequestCtx) string {
+	rctx := routeContext(ctx)
+	if rctx == nil || rctx.Routes == nil {
+		return ""
+	}
+	path := string(ctx.Path())
+	var methods []string
+	if routes, ok := rctx.Routes.(interface{ AllowedMethods(path string) []string }); ok {
+		served := routes.AllowedMethods(path)
+		for _, m := range c.methods {
+			if containsString(served, m) {
+				methods = append(methods, m)
+			}
+		}
+		return strings.Join(methods, ", ")
+	}
+	tctx := phi.NewRouteContext()
+	for _, m := range c.methods {
+		tctx.Reset()
+		if rctx.Routes.Match(tctx, m, path) {
+			methods = append(methods, m)
+		}
+	}
+	return strings.Join(methods, ", ")
+}
+
+// containsToken reports whether a list of comma separated tokens, like
+// "GET, POST", contains `token`.
+func containsToken(list, token string) bool {
+	for _, t := range strings.Split(list, ",") {
+		if strings.TrimSpace(t) == token {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+func TestCORSOrigins(t *testing.T) {
+	r := phi.NewRouter()
+	r.Use(CORS(CORSOptions{
+		AllowedOrigins:       []string{"https://example.com", "https://*.example.org"},
+		AllowedOriginRegexps: []*regexp.Regexp{regexp.MustCompile(`^http://localhost:\d+$`)},
+		AllowOriginFunc: func(ctx *fasthttp.RequestCtx, origin string) bool {
+			return origin == "https://partner.net"
+		},
+		ExposedHeaders:   []string{"X-Total"},
+		AllowCredentials: true,
+	}))
+	r.Get("/", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("ok")
+	})
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://example.com", true},
+		{"https://EXAMPLE.com", true},
+		{"http://example.com", false},
+		{"https://api.example.org", true},
+		{"https://example.org", false},
+		{"https://.example.org", false},
+		{"http://localhost:3000", true},
+		{"http://localhost", false},
+		{"https://partner.net", true},
+		{"https://evil.com", false},
+	}
+	for _, tt := range tests {
+		ctx := newRequestCtx("GET", "/")
+		ctx.Request.Header.Set("Origin", tt.origin)
+		r.Handler(ctx)
+		h := &ctx.Response.Header
+		if string(ctx.Response.Body()) != "ok" || string(h.Peek("Vary")) != "Origin" {
+			t.Errorf("%s: expecting the handler response varying on the origin", tt.origin)
+		}
+		allowOrigin := string(h.Peek("Access-Control-Allow-Origin"))
+		if (allowOrigin == tt.origin) != tt.allowed {
+			t.Errorf("%s: expecting allowed %v, got:%q", tt.origin, tt.allowed, allowOrigin)
+		}
+		if tt.allowed && (string(h.Peek("Access-Control-Allow-Credentials")) != "true" ||
+			string(h.Peek("Access-Control-Expose-Headers")) != "X-Total") {
+			t.Errorf("%s: missing credentials or exposed headers", tt.origin)
+		}
+	}
+
+	// methods not allowed get no CORS headers
+	r.Put("/", func(ctx *fasthttp.RequestCtx) {})
+	ctx := newRequestCtx("PUT", "/")
+	ctx.Request.Header.Set("Origin", "https://example.com")
+	r.Handler(ctx)
+	if len(ctx.Response.Header.Peek("Access-Control-Allow-Origin")) > 0 {
+		t.Errorf("expecting no CORS headers for a method not allowed")
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	r := phi.NewRouter()
+	r.Use(CORS(CORSOptions{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "DELETE"},
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		MaxAge:         600,
+	}))
+	r.Get("/", func(ctx *fasthttp.RequestCtx) {})
+
+	tests := []struct {
+		method, headers string
+		allowHeaders    string
+		allowed         bool
+	}{
+		{"POST", "", "", true},
+		{"delete", "content-type, authorization", "Content-Type, Authorization", true},
+		{"PUT", "", "", false},
+		{"GET", "X-Custom", "", false},
+	}
+	for _, tt := range tests {
+		ctx := newRequestCtx("OPTIONS", "/anywhere")
+		ctx.Request.Header.Set("Origin", "https://example.com")
+		ctx.Request.Header.Set("Access-Control-Request-Method", tt.method)
+		if tt.headers != "" {
+			ctx.Request.Header.Set("Access-Control-Request-Headers", tt.headers)
+		}
+		r.Handler(ctx)
+
+		h := &ctx.Response.Header
+		if ctx.Response.StatusCode() != 204 {
+			t.Errorf("%s: expecting a 204, got:%d", tt.method, ctx.Response.StatusCode())
+		}
+		if !tt.allowed {
+			if len(h.Peek("Access-Control-Allow-Origin")) > 0 {
+				t.Errorf("%s %s: expecting no CORS headers", tt.method, tt.headers)
+			}
+			continue
+		}
+		if string(h.Peek("Access-Control-Allow-Origin")) != "*" ||
+			string(h.Peek("Access-Control-Allow-Methods")) != "GET, POST, DELETE" ||
+			string(h.Peek("Access-Control-Allow-Headers")) != tt.allowHeaders ||
+			string(h.Peek("Access-Control-Max-Age")) != "600" {
+			t.Errorf("%s: unexpected preflight headers:\n%s", tt.method, h.String())
+		}
+	}
+}
+
+func TestCORSRouteMethods(t *testing.T) {
+	r := phi.NewRouter()
+	r.Use(CORS(CORSOptions{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+		RouteMethods:   true,
+	}))
+	r.Route("/users", func(r phi.Router) {
+		r.Get("/", func(ctx *fasthttp.RequestCtx) {})
+		r.Post("/", func(ctx *fasthttp.RequestCtx) {})
+		r.Put("/{id}", func(ctx *fasthttp.RequestCtx) {})
+		r.Patch("/{id}", func(ctx *fasthttp.RequestCtx) {})
+	})
+
+	preflight := func(path, method string) *fasthttp.RequestCtx {
+		ctx := newRequestCtx("OPTIONS", path)
+		ctx.Request.Header.Set("Origin", "https://example.com")
+		ctx.Request.Header.Set("Access-Control-Request-Method", method)
+		r.Handler(ctx)
+		return ctx
+	}
+
+	ctx := preflight("/users", "POST")
+	if string(ctx.Response.Header.Peek("Access-Control-Allow-Methods")) != "GET, POST" {
+		t.Errorf("expecting the methods of /users, got:\n%s", ctx.Response.Header.String())
+	}
+	ctx = preflight("/users/1", "PUT")
+	if string(ctx.Response.Header.Peek("Access-Control-Allow-Methods")) != "PUT" {
+		t.Errorf("expecting the methods of /users/1, got:\n%s", ctx.Response.Header.String())
+	}
+	ctx = preflight("/users/1", "GET")
+	if len(ctx.Response.Header.Peek("Access-Control-Allow-Origin")) > 0 {
+		t.Errorf("expecting no CORS headers for a method not registered")
+	}
+	ctx = preflight("/nowhere", "GET")
+	if ctx.Response.StatusCode() != 404 {
+		t.Errorf("expecting the preflight of a missing route to be routed, got:%d", ctx.Response.StatusCode())
+	}
+
+	// the methods served by HandleHEAD are advertised like in Allow
+	r = phi.NewRouter()
+	r.HandleHEAD = true
+	r.Use(CORS(CORSOptions{
+		AllowedOrigins: []string{"https://example.com"},
+		RouteMethods:   true,
+	}))
+	r.Route("/items", func(r phi.Router) {
+		r.Get("/", func(ctx *fasthttp.RequestCtx) {})
+	})
+	ctx = preflight("/items", "HEAD")
+	if string(ctx.Response.Header.Peek("Access-Control-Allow-Methods")) != "GET, HEAD" {
+		t.Errorf("expecting the methods of /items, got:\n%s", ctx.Response.Header.String())
+	}
+	ctx = newRequestCtx("DELETE", "/items")
+	r.Handler(ctx)
+	if string(ctx.Response.Header.Peek("Allow")) != "GET, HEAD" {
+		t.Errorf("expecting the same methods in Allow, got:\n%s", ctx.Response.Header.String())
+	}
+
+	// the methods of a mounted sub-router are advertised with its settings
+	api := phi.NewRouter()
+	api.Get("/items", func(ctx *fasthttp.RequestCtx) {})
+	r.Mount("/api", api)
+	ctx = preflight("/api/items", "GET")
+	if string(ctx.Response.Header.Peek("Access-Control-Allow-Methods")) != "GET" {
+		t.Errorf("expecting the methods of /api/items, got:\n%s", ctx.Response.Header.String())
+	}
+	ctx = preflight("/api/items", "HEAD")
+	if len(ctx.Response.Header.Peek("Access-Control-Allow-Origin")) > 0 {
+		t.Errorf("expecting no CORS headers for a method not served by the sub-router")
+	}
+}
@@ -0,0 +1,365 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// CSRFTokenKey is the user value key of the CSRF token of the request,
+	// set by the CSRF middleware.
+	CSRFTokenKey = (&contextKey{"CSRFToken"}).String()
+
+	// CSRFErrorKey is the user value key of the error of a request failing
+	// the CSRF checks.
+	CSRFErrorKey = (&contextKey{"CSRFError"}).String()
+)
+
+// The errors of the requests failing the CSRF checks.
+var (
+	ErrCSRFOrigin       = errors.New("phi: CSRF origin mismatch")
+	ErrCSRFNoReferer    = errors.New("phi: CSRF referer missing")
+	ErrCSRFTokenMissing = errors.New("phi: CSRF token missing")
+	ErrCSRFTokenInvalid = errors.New("phi: CSRF token invalid")
+)
+
+// CSRFMode is the way the CSRF middleware keeps the tokens.
+type CSRFMode int
+
+const (
+	// CSRFDoubleSubmit keeps the token in a cookie, which the requests
+	// submit back in a header or form field.
+	CSRFDoubleSubmit CSRFMode = iota
+
+	// CSRFSynchronizer keeps the token of each session in a CSRFStore.
+	CSRFSynchronizer
+)
+
+// CSRFStore keeps the CSRF tokens of the sessions in the synchronizer mode.
+type CSRFStore interface {
+	// Get returns the token of a session, if any.
+	Get(session string) (string, bool)
+
+	// Set sets the token of a session.
+	Set(session, token string)
+}
+
+// CSRFOptions configures the CSRF middleware.
+type CSRFOptions struct {
+	// Mode is the way the tokens are kept, CSRFDoubleSubmit by default.
+	Mode CSRFMode
+
+	// Store keeps the tokens in the CSRFSynchronizer mode, an in-memory
+	// store if nil.
+	Store CSRFStore
+
+	// Session returns the session of a request in the CSRFSynchronizer
+	// mode, like its session cookie. It's required in this mode.
+	Session KeyFunc
+
+	// CookieName is the name of the token cookie in the CSRFDoubleSubmit
+	// mode, "_csrf" by default. The cookie is HttpOnly, SameSite Lax, and
+	// secure on TLS connections.
+	CookieName string
+
+	// CookiePath and CookieDomain are the path and domain of the cookie,
+	// "/" and the request host by default.
+	CookiePath   string
+	CookieDomain string
+
+	// CookieMaxAge is the max age of the cookie in seconds, a session
+	// cookie if zero.
+	CookieMaxAge int
+
+	// HeaderName is the request header holding the token, "X-CSRF-Token"
+	// by default.
+	HeaderName string
+
+	// FieldName is the form field holding the token, "csrf_token" by
+	// default.
+	FieldName string
+
+	// TrustedOrigins lists the origins allowed to make unsafe requests
+	// along with the request's own, like "https://app.example.com".
+	TrustedOrigins []string
+
+	// Exempt lists the routing patterns of the routes exempted from the
+	// CSRF checks, like "/webhooks/{provider}".
+	Exempt []string
+
+	// Failure handles the requests failing the CSRF checks, with the
+	// reason available from CSRFError. They're responded to with the
+	// error handler of the Mux with a 403 by default.
+	Failure phi.RequestHandlerFunc
+}
+
+// csrfTokenLen is the length of the tokens, in bytes.
+const csrfTokenLen = 32
+
+// CSRF returns a middleware protecting the requests with unsafe methods,
+// anything but GET, HEAD, OPTIONS and TRACE, from cross-site request
+// forgery. Their Origin, or Referer, must be the request's own origin or a
+// trusted one, and they must submit the token of the session, which the
+// handlers render in their pages and forms with CSRFToken.
+//
+// The exempted routes are found with phi.Routes.Match when the middleware
+// is used before routing.
+func CSRF(opts CSRFOptions) phi.Middleware {
+	if opts.Mode == CSRFSynchronizer && opts.Session == nil {
+		panic("phi: the CSRF synchronizer mode requires a Session func")
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryCSRFStore()
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = "_csrf"
+	}
+	if opts.CookiePath == "" {
+		opts.CookiePath = "/"
+	}
+	if opts.HeaderName == "" {
+		opts.HeaderName = "X-CSRF-Token"
+	}
+	if opts.FieldName == "" {
+		opts.FieldName = "csrf_token"
+	}
+	if opts.Failure == nil {
+		opts.Failure = csrfFailure
+	}
+	trusted := make(map[string]bool, len(opts.TrustedOrigins))
+	for _, o := range opts.TrustedOrigins {
+		trusted[strings.ToLower(strings.TrimSuffix(o, "/"))] = true
+	}
+	exempt := make(map[string]bool, len(opts.Exempt))
+	for _, p := range opts.Exempt {
+		exempt[p] = true
+	}
+	c := &csrf{opts: opts, trusted: trusted, exempt: exempt}
+
+	return func(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+		return func(ctx *fasthttp.RequestCtx) {
+			token := c.token(ctx)
+			if token != nil {
+				ctx.SetUserValue(CSRFTokenKey, maskCSRFToken(token))
+			}
+
+			if csrfSafeMethod(ctx) || c.isExempt(ctx) {
+				next(ctx)
+				return
+			}
+			if err := c.check(ctx, token); err != nil {
+				ctx.SetUserValue(CSRFErrorKey, err)
+				c.opts.Failure(ctx)
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// CSRFToken returns the CSRF token of the request, to render in a header
+// or form field of the pages. The token is masked differently on each
+// request, so it doesn't leak through compressed responses.
+func CSRFToken(ctx *fasthttp.RequestCtx) string {
+	token, _ := ctx.UserValue(CSRFTokenKey).(string)
+	return token
+}
+
+// CSRFError returns the reason of a request failing the CSRF checks.
+func CSRFError(ctx *fasthttp.RequestCtx) error {
+	err, _ := ctx.UserValue(CSRFErrorKey).(error)
+	return err
+}
+
+func csrfFailure(ctx *fasthttp.RequestCtx) {
+	serveError(ctx, &phi.HTTPError{Status: fasthttp.StatusForbidden, Err: CSRFError(ctx)})
+}
+
+type csrf struct {
+	opts    CSRFOptions
+	trusted map[string]bool
+	exempt  map[string]bool
+}
+
+// token returns the token of the session, which is created if missing.
+func (c *csrf) token(ctx *fasthttp.RequestCtx) []byte {
+	if c.opts.Mode == CSRFSynchronizer {
+		session := c.opts.Session(ctx)
+		if session == "" {
+			return nil
+		}
+		if t, ok := c.opts.Store.Get(session); ok {
+			if token, err := base64.RawURLEncoding.DecodeString(t); err == nil && len(token) == csrfTokenLen {
+				return token
+			}
+		}
+		token := newCSRFToken()
+		c.opts.Store.Set(session, base64.RawURLEncoding.EncodeToString(token))
+		return token
+	}
+
+	cookie := ctx.Request.Header.Cookie(c.opts.CookieName)
+	if token, err := base64.RawURLEncoding.DecodeString(string(cookie)); err == nil && len(token) == csrfTokenLen {
+		return token
+	}
+	token := newCSRFToken()
+	ck := fasthttp.AcquireCookie()
+	ck.SetKey(c.opts.CookieName)
+	ck.SetValue(base64.RawURLEncoding.EncodeToString(token))
+	ck.SetPath(c.opts.CookiePath)
+	ck.SetDomain(c.opts.CookieDomain)
+	ck.SetMaxAge(c.opts.CookieMaxAge)
+	ck.SetHTTPOnly(true)
+	ck.SetSecure(ctx.IsTLS())
+	ck.SetSameSite(fasthttp.CookieSameSiteLaxMode)
+	ctx.Response.Header.SetCookie(ck)
+	fasthttp.ReleaseCookie(ck)
+	return token
+}
+
+func (c *csrf) isExempt(ctx *fasthttp.RequestCtx) bool {
+	if len(c.exempt) == 0 {
+		return false
+	}
+	rctx := routeContext(ctx)
+	if rctx == nil {
+		return false
+	}
+	pattern := rctx.RoutePattern()
+	if pattern == "" && rctx.Routes != nil {
+		tctx := phi.NewRouteContext()
+		if rctx.Routes.Match(tctx, string(ctx.Method()), string(ctx.Path())) {
+			pattern = tctx.RoutePattern()
+		}
+	}
+	return c.exempt[pattern]
+}
+
+// check checks the origin and the token of an unsafe request.
+func (c *csrf) check(ctx *fasthttp.RequestCtx, token []byte) error {
+	if origin := ctx.Request.Header.Peek("Origin"); len(origin) > 0 {
+		if !c.sameOrigin(ctx, string(origin)) {
+			return ErrCSRFOrigin
+		}
+	} else if referer := ctx.Request.Header.Referer(); len(referer) > 0 {
+		u, err := url.Parse(string(referer))
+		if err != nil || !c.sameOrigin(ctx, u.Scheme+"://"+u.Host) {
+			return ErrCSRFOrigin
+		}
+	} else if ctx.IsTLS() {
+		// browsers send a Referer along with the HTTPS requests, unless
+		// told not to
+		return ErrCSRFNoReferer
+	}
+
+	submitted := ctx.Request.Header.Peek(c.opts.HeaderName)
+	if len(submitted) == 0 {
+		submitted = ctx.PostArgs().Peek(c.opts.FieldName)
+	}
+	if len(submitted) == 0 {
+		if mf, err := ctx.MultipartForm(); err == nil {
+			if vs := mf.Value[c.opts.FieldName]; len(vs) > 0 {
+				submitted = []byte(vs[0])
+			}
+		}
+	}
+	if len(submitted) == 0 {
+		return ErrCSRFTokenMissing
+	}
+	if token == nil || !validCSRFToken(token, submitted) {
+		return ErrCSRFTokenInvalid
+	}
+	return nil
+}
+
+func (c *csrf) sameOrigin(ctx *fasthttp.RequestCtx, origin string) bool {
+	origin = strings.ToLower(origin)
+	scheme := "http://"
+	if ctx.IsTLS() {
+		scheme = "https://"
+	}
+	return origin == scheme+strings.ToLower(string(ctx.Host())) || c.trusted[origin]
+}
+
+func csrfSafeMethod(ctx *fasthttp.RequestCtx) bool {
+	switch string(ctx.Method()) {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+func newCSRFToken() []byte {
+	token := make([]byte, csrfTokenLen)
+	if _, err := rand.Read(token); err != nil {
+		panic("phi: failed to generate a CSRF token: " + err.Error())
+	}
+	return token
+}
+
+// maskCSRFToken masks a token with a one-time pad, prepended to it.
+func maskCSRFToken(token []byte) string {
+	masked := make([]byte, 2*csrfTokenLen)
+	pad := newCSRFToken()
+	copy(masked, pad)
+	for i := range token {
+		masked[csrfTokenLen+i] = token[i] ^ pad[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// validCSRFToken reports whether a masked token submitted is the token of
+// the session.
+func validCSRFToken(token, submitted []byte) bool {
+	masked, err := base64.RawURLEncoding.DecodeString(string(submitted))
+	if err != nil || len(masked) != 2*csrfTokenLen {
+		return false
+	}
+	unmasked := make([]byte, csrfTokenLen)
+	for i := range unmasked {
+		unmasked[i] = masked[csrfTokenLen+i] ^ masked[i]
+	}
+	return subtle.ConstantTimeCompare(unmasked, token) == 1
+}
+
+// MemoryCSRFStore is an in-memory CSRFStore, for the sessions of a single
+// server. The tokens of ended sessions should be deleted.
+type MemoryCSRFStore struct {
+	mu     sync.RWMutex
+	tokens map[string]string
+}
+
+// NewMemoryCSRFStore returns an empty MemoryCSRFStore.
+func NewMemoryCSRFStore() *MemoryCSRFStore {
+	return &MemoryCSRFStore{tokens: make(map[string]string)}
+}
+
+// Get implements CSRFStore.
+func (s *MemoryCSRFStore) Get(session string) (string, bool) {
+	s.mu.RLock()
+	token, ok := s.tokens[session]
+	s.mu.RUnlock()
+	return token, ok
+}
+
+// Set implements CSRFStore.
+func (s *MemoryCSRFStore) Set(session, token string) {
+	s.mu.Lock()
+	s.tokens[session] = token
+	s.mu.Unlock()
+}
+
+// Delete deletes the token of a session.
+func (s *MemoryCSRFStore) Delete(session string) {
+	s.mu.Lock()
+	delete(s.tokens, session)
+	s.mu.Unlock()
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	r := phi.NewRouter()
+	r.Use(CSRF(CSRFOptions{
+		TrustedOrigins: []string{"https://app.example.com"},
+		Exempt:         []string{"/webhooks/{provider}"},
+	}))
+	r.Get("/form", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString(CSRFToken(ctx))
+	})
+	r.Post("/form", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("saved")
+	})
+	r.Post("/webhooks/{provider}", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("hooked")
+	})
+
+	// the form page sets the token cookie
+	ctx := newRequestCtx("GET", "/form")
+	r.Handler(ctx)
+	var cookie fasthttp.Cookie
+	cookie.SetKey("_csrf")
+	if !ctx.Response.Header.Cookie(&cookie) || !cookie.HTTPOnly() || cookie.SameSite() != fasthttp.CookieSameSiteLaxMode {
+		t.Fatalf("expecting the token cookie, got:\n%s", ctx.Response.Header.String())
+	}
+	token := string(ctx.Response.Body())
+
+	// tokens are masked differently on each request
+	ctx = newRequestCtx("GET", "/form")
+	ctx.Request.Header.SetCookie("_csrf", string(cookie.Value()))
+	r.Handler(ctx)
+	token2 := string(ctx.Response.Body())
+	if token2 == token || len(ctx.Response.Header.PeekCookie("_csrf")) > 0 {
+		t.Errorf("expecting a masked token and the cookie to be kept")
+	}
+
+	post := func(path, origin, token, form string) *fasthttp.RequestCtx {
+		ctx := newRequestCtx("POST", path)
+		ctx.Request.Header.SetCookie("_csrf", string(cookie.Value()))
+		if origin != "" {
+			ctx.Request.Header.Set("Origin", origin)
+		}
+		if token != "" {
+			ctx.Request.Header.Set("X-CSRF-Token", token)
+		}
+		if form != "" {
+			ctx.Request.Header.SetContentType("application/x-www-form-urlencoded")
+			ctx.Request.SetBodyString(form)
+		}
+		r.Handler(ctx)
+		return ctx
+	}
+
+	tests := []struct {
+		name                string
+		path, origin, token string
+		form                string
+		status              int
+	}{
+		{"header token", "/form", "http://example.com", token, "", 200},
+		{"form token", "/form", "", "", "csrf_token=" + token2, 200},
+		{"trusted origin", "/form", "https://app.example.com", token, "", 200},
+		{"cross origin", "/form", "https://evil.com", token, "", 403},
+		{"missing token", "/form", "http://example.com", "", "", 403},
+		{"invalid token", "/form", "http://example.com", strings.Repeat("A", len(token)), "", 403},
+		{"exempt", "/webhooks/stripe", "https://stripe.com", "", "", 200},
+	}
+	for _, tt := range tests {
+		ctx := post(tt.path, tt.origin, tt.token, tt.form)
+		if ctx.Response.StatusCode() != tt.status {
+			t.Errorf("%s: expecting a %d, got:%d %s", tt.name, tt.status, ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+	}
+
+	ctx = newRequestCtx("POST", "/form")
+	ctx.Request.Header.Set("Referer", "https://evil.com/page")
+	ctx.Request.Header.Set("X-CSRF-Token", token)
+	r.Handler(ctx)
+	if ctx.Response.StatusCode() != 403 {
+		t.Errorf("expecting a cross origin referer to fail, got:%d", ctx.Response.StatusCode())
+	}
+}
+
+func TestCSRFSynchronizer(t *testing.T) {
+	store := NewMemoryCSRFStore()
+	var failure error
+	r := phi.NewRouter()
+	r.Use(CSRF(CSRFOptions{
+		Mode:    CSRFSynchronizer,
+		Store:   store,
+		Session: KeyByHeader("X-Session"),
+		Failure: func(ctx *fasthttp.RequestCtx) {
+			failure = CSRFError(ctx)
+			ctx.Error("csrf", 400)
+		},
+	}))
+	r.Get("/", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString(CSRFToken(ctx))
+	})
+	r.Post("/", func(ctx *fasthttp.RequestCtx) {})
+
+	get := func(session string) string {
+		ctx := newRequestCtx("GET", "/")
+		ctx.Request.Header.Set("X-Session", session)
+		r.Handler(ctx)
+		if len(ctx.Response.Header.PeekCookie("_csrf")) > 0 {
+			t.Errorf("expecting no cookie in the synchronizer mode")
+		}
+		return string(ctx.Response.Body())
+	}
+	post := func(session, token string) int {
+		ctx := newRequestCtx("POST", "/")
+		ctx.Request.Header.Set("X-Session", session)
+		ctx.Request.Header.Set("X-CSRF-Token", token)
+		r.Handler(ctx)
+		return ctx.Response.StatusCode()
+	}
+
+	a, b := get("a"), get("b")
+	if status := post("a", a); status != 200 {
+		t.Errorf("expecting the token of the session to be valid, got:%d", status)
+	}
+	if status := post("a", b); status != 400 || failure != ErrCSRFTokenInvalid {
+		t.Errorf("expecting the token of another session to fail, got:%d %v", status, failure)
+	}
+	if status := post("", a); status != 400 || failure != ErrCSRFTokenInvalid {
+		t.Errorf("expecting a request without session to fail, got:%d %v", status, failure)
+	}
+	store.Delete("a")
+	if status := post("a", a); status != 400 {
+		t.Errorf("expecting the token of an ended session to fail, got:%d", status)
+	}
+}
@@ -0,0 +1,465 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// ClaimsKey is the user value key of the claims of the JWT verified by
+	// the JWTAuth middleware.
+	ClaimsKey = (&contextKey{"Claims"}).String()
+)
+
+// The errors of JWT verification.
+var (
+	ErrJWTMalformed   = errors.New("phi: malformed token")
+	ErrJWTAlgorithm   = errors.New("phi: unsupported token algorithm")
+	ErrJWTUnknownKey  = errors.New("phi: unknown token key")
+	ErrJWTSignature   = errors.New("phi: invalid token signature")
+	ErrJWTExpired     = errors.New("phi: token is expired")
+	ErrJWTNotValidYet = errors.New("phi: token is not valid yet")
+	ErrJWTIssuer      = errors.New("phi: invalid token issuer")
+	ErrJWTAudience    = errors.New("phi: invalid token audience")
+)
+
+// errJWTUnsupportedEd skips the Ed25519 keys of JWKS documents, which are
+// only verified with the crypto/ed25519 package of go1.13.
+var errJWTUnsupportedEd = errors.New("phi: EdDSA keys require go1.13")
+
+// Claims are the claims of a JWT, decoded from JSON with numbers as
+// json.Number.
+type Claims map[string]interface{}
+
+// Subject returns the "sub" claim.
+func (c Claims) Subject() string {
+	s, _ := c["sub"].(string)
+	return s
+}
+
+// Issuer returns the "iss" claim.
+func (c Claims) Issuer() string {
+	s, _ := c["iss"].(string)
+	return s
+}
+
+// Audience returns the "aud" claim, which is either a string or an array
+// of strings.
+func (c Claims) Audience() []string {
+	switch aud := c["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		auds := make([]string, 0, len(aud))
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				auds = append(auds, s)
+			}
+		}
+		return auds
+	}
+	return nil
+}
+
+// time returns a NumericDate claim, like "exp".
+func (c Claims) time(key string) (time.Time, bool, error) {
+	v, ok := c[key]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false, ErrJWTMalformed
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false, ErrJWTMalformed
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)), true, nil
+}
+
+// GetClaims returns the claims of the JWT verified by the JWTAuth
+// middleware, if any.
+func GetClaims(ctx *fasthttp.RequestCtx) Claims {
+	claims, _ := ctx.UserValue(ClaimsKey).(Claims)
+	return claims
+}
+
+// JWTOptions configures a JWTVerifier.
+type JWTOptions struct {
+	// JWKSFile is the path of the JWKS document holding the verification
+	// keys. It's reloaded when it changes, see ReloadInterval.
+	JWKSFile string
+
+	// ReloadInterval is the minimum time between two checks of the JWKS
+	// file for changes, 10 seconds if zero.
+	ReloadInterval time.Duration
+
+	// Issuer, if set, is the required "iss" claim.
+	Issuer string
+
+	// Audience, if set, is required among the "aud" claims.
+	Audience string
+
+	// Leeway is the clock skew allowed when checking the "exp" and "nbf"
+	// claims.
+	Leeway time.Duration
+
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+const defaultJWKSReloadInterval = 10 * time.Second
+
+// JWTVerifier verifies JWTs signed with HS256, RS256, ES256 or EdDSA, with
+// the keys of a JWKS document on disk.
+type JWTVerifier struct {
+	opts JWTOptions
+	keys atomic.Value // *jwkSet
+
+	checked int64 // unix time of the last check of the file, in ns
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// NewJWTVerifier returns a JWTVerifier, with the keys of the JWKS file of
+// `opts` loaded.
+func NewJWTVerifier(opts JWTOptions) (*JWTVerifier, error) {
+	if opts.ReloadInterval <= 0 {
+		opts.ReloadInterval = defaultJWKSReloadInterval
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	v := &JWTVerifier{opts: opts}
+	fi, err := os.Stat(opts.JWKSFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.load(fi); err != nil {
+		return nil, err
+	}
+	v.checked = opts.Now().UnixNano()
+	return v, nil
+}
+
+// JWTAuth is a middleware authenticating the requests with the JWT bearer
+// token of their Authorization header, verified by `v`. The claims of the
+// token are available to the handlers with GetClaims, and its subject is
+// the principal of the request. Failures are handled like with BearerAuth.
+func JWTAuth(realm string, v *JWTVerifier) phi.Middleware {
+	return BearerAuth(realm, func(ctx *fasthttp.RequestCtx, token string) (interface{}, error) {
+		claims, err := v.Verify(token)
+		if err != nil {
+			return nil, err
+		}
+		ctx.SetUserValue(ClaimsKey, claims)
+		return claims.Subject(), nil
+	})
+}
+
+// Verify verifies the signature and the claims of a JWT, and returns its
+// claims.
+func (v *JWTVerifier) Verify(token string) (Claims, error) {
+	v.reload()
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrJWTMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrJWTMalformed
+	}
+	if _, ok := jwtAlgorithms[header.Alg]; !ok {
+		return nil, ErrJWTAlgorithm
+	}
+
+	input := []byte(token[:len(parts[0])+1+len(parts[1])])
+	if err := v.keys.Load().(*jwkSet).verify(header.Alg, header.Kid, input, sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// decodeJWTPart decodes the header or the payload of a JWT, which must be
+// a single JSON object.
+func decodeJWTPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return ErrJWTMalformed
+	}
+	if b = bytes.TrimLeft(b, " \t\r\n"); len(b) == 0 || b[0] != '{' {
+		return ErrJWTMalformed
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return ErrJWTMalformed
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return ErrJWTMalformed
+	}
+	return nil
+}
+
+func (v *JWTVerifier) checkClaims(claims Claims) error {
+	now := v.opts.Now()
+	exp, ok, err := claims.time("exp")
+	if err != nil {
+		return err
+	}
+	if ok && !now.Before(exp.Add(v.opts.Leeway)) {
+		return ErrJWTExpired
+	}
+	nbf, ok, err := claims.time("nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(v.opts.Leeway).Before(nbf) {
+		return ErrJWTNotValidYet
+	}
+
+	if v.opts.Issuer != "" && claims.Issuer() != v.opts.Issuer {
+		return ErrJWTIssuer
+	}
+	if v.opts.Audience != "" {
+		for _, aud := range claims.Audience() {
+			if aud == v.opts.Audience {
+				return nil
+			}
+		}
+		return ErrJWTAudience
+	}
+	return nil
+}
+
+// reload reloads the JWKS file if it changed since it was last checked, at
+// most once per reload interval. The keys are kept when it's invalid.
+func (v *JWTVerifier) reload() {
+	now := v.opts.Now().UnixNano()
+	checked := atomic.LoadInt64(&v.checked)
+	if now-checked < int64(v.opts.ReloadInterval) || !atomic.CompareAndSwapInt64(&v.checked, checked, now) {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fi, err := os.Stat(v.opts.JWKSFile)
+	if err != nil || (fi.ModTime().Equal(v.modTime) && fi.Size() == v.size) {
+		return
+	}
+	v.load(fi)
+}
+
+func (v *JWTVerifier) load(fi os.FileInfo) error {
+	b, err := ioutil.ReadFile(v.opts.JWKSFile)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(b)
+	if err != nil {
+		return fmt.Errorf("phi: invalid JWKS file '%s': %v", v.opts.JWKSFile, err)
+	}
+	v.keys.Store(keys)
+	v.modTime, v.size = fi.ModTime(), fi.Size()
+	return nil
+}
+
+// jwtAlgorithms are the supported signing algorithms, with their key types.
+var jwtAlgorithms = map[string]string{
+	"HS256": "oct",
+	"RS256": "RSA",
+	"ES256": "EC",
+	"EdDSA": "OKP",
+}
+
+type jwk struct {
+	kid string
+	alg string
+	kty string
+	key interface{}
+}
+
+type jwkSet struct {
+	keys []jwk
+}
+
+// parseJWKS parses a JWKS document, skipping the keys of unsupported types
+// or uses.
+func parseJWKS(b []byte) (*jwkSet, error) {
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	set := &jwkSet{}
+	for i, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if k.Alg != "" && jwtAlgorithms[k.Alg] != k.Kty {
+			continue
+		}
+
+		var key interface{}
+		var err error
+		switch k.Kty {
+		case "oct":
+			key, err = base64.RawURLEncoding.DecodeString(k.K)
+		case "RSA":
+			key, err = rsaJWK(k.N, k.E)
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			key, err = ecJWK(k.X, k.Y)
+		case "OKP":
+			if k.Crv != "Ed25519" {
+				continue
+			}
+			var x []byte
+			if x, err = base64.RawURLEncoding.DecodeString(k.X); err == nil {
+				key, err = ed25519JWK(x)
+			}
+			if err == errJWTUnsupportedEd {
+				continue
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %v", i, err)
+		}
+		set.keys = append(set.keys, jwk{kid: k.Kid, alg: k.Alg, kty: k.Kty, key: key})
+	}
+	return set, nil
+}
+
+func rsaJWK(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, err
+	}
+	if len(eb) == 0 || len(eb) > 4 {
+		return nil, errors.New("invalid RSA exponent")
+	}
+	var exp int
+	for _, b := range eb {
+		exp = exp<<8 | int(b)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: exp}, nil
+}
+
+func ecJWK(x, y string) (*ecdsa.PublicKey, error) {
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, err
+	}
+	yb, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, err
+	}
+	key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("invalid EC point")
+	}
+	return key, nil
+}
+
+// verify verifies a signature with the key of `kid`, or with any key of
+// the algorithm's type when the token has no key ID.
+func (s *jwkSet) verify(alg, kid string, input, sig []byte) error {
+	kty := jwtAlgorithms[alg]
+	found := false
+	for _, k := range s.keys {
+		if k.kty != kty || (k.alg != "" && k.alg != alg) || (kid != "" && k.kid != kid) {
+			continue
+		}
+		found = true
+		if verifyJWTSignature(alg, k.key, input, sig) {
+			return nil
+		}
+	}
+	if !found {
+		return ErrJWTUnknownKey
+	}
+	return ErrJWTSignature
+}
+
+func verifyJWTSignature(alg string, key interface{}, input, sig []byte) bool {
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write(input)
+		return hmac.Equal(mac.Sum(nil), sig)
+	case "RS256":
+		h := sha256.Sum256(input)
+		return rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, h[:], sig) == nil
+	case "ES256":
+		if len(sig) != 64 {
+			return false
+		}
+		h := sha256.Sum256(input)
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(key.(*ecdsa.PublicKey), h[:], r, s)
+	case "EdDSA":
+		return verifyEd25519(key, input, sig)
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+//go:build go1.13
+// +build go1.13
+
+package middleware
+
+import (
+	"crypto/ed25519"
+	"errors"
+)
+
+func ed25519JWK(x []byte) (interface{}, error) {
+	if len(x) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid Ed25519 key")
+	}
+	return ed25519.PublicKey(x), nil
+}
+
+func verifyEd25519(key interface{}, input, sig []byte) bool {
+	return ed25519.Verify(key.(ed25519.PublicKey), input, sig)
+}
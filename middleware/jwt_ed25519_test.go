@@ -0,0 +1,42 @@
+//go:build go1.13
+// +build go1.13
+
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestJWTVerifierEdDSA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "phi-jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	v, err := NewJWTVerifier(JWTOptions{
+		JWKSFile: writeJWKS(t, dir, map[string]string{"kty": "OKP", "crv": "Ed25519", "kid": "ed", "x": b64.EncodeToString(pub)}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(key ed25519.PrivateKey) func([]byte) []byte {
+		return func(input []byte) []byte {
+			return ed25519.Sign(key, input)
+		}
+	}
+	c, err := v.Verify(signJWT(t, "EdDSA", "ed", sign(priv), map[string]interface{}{"sub": "carol"}))
+	if err != nil || c.Subject() != "carol" {
+		t.Errorf("expecting the EdDSA token to verify, got:%v %v", c, err)
+	}
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := v.Verify(signJWT(t, "EdDSA", "ed", sign(other), nil)); err != ErrJWTSignature {
+		t.Errorf("expecting a signature error, got:%v", err)
+	}
+}
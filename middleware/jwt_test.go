@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+var b64 = base64.RawURLEncoding
+
+// signJWT returns a JWT of `claims` signed with `key`, or by `key` when
+// it's a func.
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	h := sha256.Sum256([]byte(input))
+
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, h[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, h[:])
+		sig = make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[32-len(rb):32], rb)
+		copy(sig[64-len(sb):], sb)
+	case func([]byte) []byte:
+		sig = k([]byte(input))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + b64.EncodeToString(sig)
+}
+
+// signJWTPayload signs a raw payload with HS256.
+func signJWTPayload(kid string, secret []byte, payload string) string {
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "kid": kid, "typ": "JWT"})
+	input := b64.EncodeToString(header) + "." + b64.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return input + "." + b64.EncodeToString(mac.Sum(nil))
+}
+
+// writeJWKS writes a JWKS document of `keys` to a file of `dir`.
+func writeJWKS(t *testing.T, dir string, keys ...map[string]string) string {
+	b, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	path := filepath.Join(dir, "jwks.json")
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestJWTVerifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "phi-jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	path := writeJWKS(t, dir,
+		map[string]string{"kty": "oct", "kid": "hs", "k": b64.EncodeToString(secret)},
+		map[string]string{"kty": "RSA", "kid": "rs", "alg": "RS256", "n": b64.EncodeToString(rsaKey.N.Bytes()), "e": "AQAB"},
+		map[string]string{"kty": "EC", "kid": "es", "crv": "P-256", "x": b64.EncodeToString(ecKey.X.Bytes()), "y": b64.EncodeToString(ecKey.Y.Bytes())},
+		map[string]string{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	)
+
+	now := time.Unix(1500000000, 0)
+	v, err := NewJWTVerifier(JWTOptions{
+		JWKSFile: path,
+		Issuer:   "https://issuer.example.com",
+		Audience: "api",
+		Leeway:   time.Minute,
+		Now:      func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "alice",
+			"iss": "https://issuer.example.com",
+			"aud": []string{"web", "api"},
+			"exp": now.Add(time.Hour).Unix(),
+			"nbf": now.Add(-time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+
+	otherRSA, _ := rsa.GenerateKey(rand.Reader, 2048)
+	payload, _ := json.Marshal(claims(nil))
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"HS256", signJWT(t, "HS256", "hs", secret, claims(nil)), nil},
+		{"RS256", signJWT(t, "RS256", "rs", rsaKey, claims(nil)), nil},
+		{"ES256", signJWT(t, "ES256", "es", ecKey, claims(nil)), nil},
+		{"no kid", signJWT(t, "ES256", "", ecKey, claims(nil)), nil},
+		{"audience string", signJWT(t, "HS256", "hs", secret, claims(map[string]interface{}{"aud": "api"})), nil},
+		{"expired within leeway", signJWT(t, "HS256", "hs", secret, claims(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()})), nil},
+		{"expired", signJWT(t, "HS256", "hs", secret, claims(map[string]interface{}{"exp": now.Add(-2 * time.Minute).Unix()})), ErrJWTExpired},
+		{"not valid yet", signJWT(t, "HS256", "hs", secret, claims(map[string]interface{}{"nbf": now.Add(2 * time.Minute).Unix()})), ErrJWTNotValidYet},
+		{"issuer", signJWT(t, "HS256", "hs", secret, claims(map[string]interface{}{"iss": "evil"})), ErrJWTIssuer},
+		{"audience", signJWT(t, "HS256", "hs", secret, claims(map[string]interface{}{"aud": "web"})), ErrJWTAudience},
+		{"wrong key", signJWT(t, "RS256", "rs", otherRSA, claims(nil)), ErrJWTSignature},
+		{"unknown kid", signJWT(t, "HS256", "nope", secret, claims(nil)), ErrJWTUnknownKey},
+		{"algorithm confusion", signJWT(t, "HS256", "rs", []byte(b64.EncodeToString(rsaKey.N.Bytes())), claims(nil)), ErrJWTUnknownKey},
+		{"none", "eyJhbGciOiJub25lIn0.e30.", ErrJWTAlgorithm},
+		{"malformed", "abc", ErrJWTMalformed},
+		{"null payload", signJWTPayload("hs", secret, "null"), ErrJWTMalformed},
+		{"array payload", signJWTPayload("hs", secret, `["alice"]`), ErrJWTMalformed},
+		{"trailing bytes", signJWTPayload("hs", secret, `{"sub":"alice"}{"sub":"bob"}`), ErrJWTMalformed},
+		{"trailing garbage", signJWTPayload("hs", secret, `{"sub":"alice"} x`), ErrJWTMalformed},
+		{"trailing space", signJWTPayload("hs", secret, string(payload)+" "), nil},
+	}
+	for _, tt := range tests {
+		c, err := v.Verify(tt.token)
+		if err != tt.err {
+			t.Errorf("%s: expecting error %v, got:%v", tt.name, tt.err, err)
+			continue
+		}
+		if err == nil && c.Subject() != "alice" {
+			t.Errorf("%s: unexpected claims %v", tt.name, c)
+		}
+	}
+
+	// the keys are reloaded once the file changes
+	newSecret := []byte("fedcba9876543210fedcba9876543210")
+	writeJWKS(t, dir, map[string]string{"kty": "oct", "kid": "hs2", "k": b64.EncodeToString(newSecret)})
+	os.Chtimes(path, now, now.Add(time.Second))
+	token := signJWT(t, "HS256", "hs2", newSecret, claims(nil))
+	if _, err := v.Verify(token); err != ErrJWTUnknownKey {
+		t.Errorf("expecting the keys to be checked at the reload interval, got:%v", err)
+	}
+	now = now.Add(defaultJWKSReloadInterval)
+	if _, err := v.Verify(token); err != nil {
+		t.Errorf("expecting the keys to be reloaded, got:%v", err)
+	}
+}
+
+func TestJWTAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "phi-jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	v, err := NewJWTVerifier(JWTOptions{
+		JWKSFile: writeJWKS(t, dir, map[string]string{"kty": "oct", "k": b64.EncodeToString(secret)}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := phi.NewRouter()
+	r.Route("/api", func(r phi.Router) {
+		r.Use(JWTAuth("api", v))
+		r.Get("/me", func(ctx *fasthttp.RequestCtx) {
+			ctx.WriteString(GetPrincipal(ctx).(string) + " " + GetClaims(ctx)["role"].(string))
+		})
+	})
+
+	ctx := newRequestCtx("GET", "/api/me")
+	ctx.Request.Header.Set("Authorization", "Bearer "+signJWT(t, "HS256", "", secret, map[string]interface{}{"sub": "bob", "role": "admin"}))
+	r.Handler(ctx)
+	if ctx.Response.StatusCode() != 200 || string(ctx.Response.Body()) != "bob admin" {
+		t.Errorf("expecting the claims, got:%d %s", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	ctx = newRequestCtx("GET", "/api/me")
+	ctx.Request.Header.Set("Authorization", "Bearer "+signJWT(t, "HS256", "", []byte("wrong"), map[string]interface{}{"sub": "bob"}))
+	r.Handler(ctx)
+	if ctx.Response.StatusCode() != 401 || string(ctx.Response.Header.Peek("WWW-Authenticate")) != `Bearer realm="api", error="invalid_token"` {
+		t.Errorf("expecting a 401, got:%d\n%s", ctx.Response.StatusCode(), ctx.Response.Header.String())
+	}
+}
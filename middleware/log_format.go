@@ -0,0 +1,265 @@
+package middleware
+
+import (
+	"net"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// CombinedLogFormat formats requests in the Apache combined log format:
+//
+//	127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.1" 200 2326 "http://example.com/" "Mozilla/5.0"
+func CombinedLogFormat(dst []byte, e *LogEntry) []byte {
+	dst = appendIP(dst, e.RemoteIP)
+	dst = append(dst, " - - ["...)
+	dst = e.Time.AppendFormat(dst, "02/Jan/2006:15:04:05 -0700")
+	dst = append(dst, "] \""...)
+	dst = append(dst, e.Method...)
+	dst = append(dst, ' ')
+	dst = append(dst, e.RequestURI...)
+	dst = append(dst, ' ')
+	dst = append(dst, e.Proto...)
+	dst = append(dst, "\" "...)
+	dst = strconv.AppendInt(dst, int64(e.Status), 10)
+	dst = append(dst, ' ')
+	if e.Bytes > 0 {
+		dst = strconv.AppendInt(dst, int64(e.Bytes), 10)
+	} else {
+		dst = append(dst, '-')
+	}
+	dst = append(dst, ' ')
+	dst = appendCombinedHeader(dst, e.Referer)
+	dst = append(dst, ' ')
+	dst = appendCombinedHeader(dst, e.UserAgent)
+	return append(dst, '\n')
+}
+
+func appendCombinedHeader(dst, value []byte) []byte {
+	if len(value) == 0 {
+		return append(dst, "\"-\""...)
+	}
+	dst = append(dst, '"')
+	for _, c := range value {
+		if c == '"' || c == '\\' {
+			dst = append(dst, '\\')
+		}
+		dst = append(dst, c)
+	}
+	return append(dst, '"')
+}
+
+// LogfmtLogFormat formats requests as logfmt key/value pairs:
+//
+//	time=2019-03-01T13:55:36Z method=GET path=/users/1 route=/users/{id} status=200 bytes=42 latency_ms=0.153 ip=127.0.0.1 request_id=c1
+func LogfmtLogFormat(dst []byte, e *LogEntry) []byte {
+	dst = append(dst, "time="...)
+	dst = e.Time.AppendFormat(dst, time.RFC3339)
+	dst = append(dst, " method="...)
+	dst = appendLogfmtValue(dst, e.Method)
+	dst = append(dst, " path="...)
+	dst = appendLogfmtValue(dst, e.Path)
+	dst = append(dst, " route="...)
+	dst = appendLogfmtValue(dst, e.RoutePattern)
+	dst = append(dst, " status="...)
+	dst = strconv.AppendInt(dst, int64(e.Status), 10)
+	dst = append(dst, " bytes="...)
+	dst = strconv.AppendInt(dst, int64(e.Bytes), 10)
+	dst = append(dst, " latency_ms="...)
+	dst = appendMillis(dst, e.Latency)
+	dst = append(dst, " ip="...)
+	dst = appendIP(dst, e.RemoteIP)
+	dst = append(dst, " request_id="...)
+	dst = appendLogfmtValue(dst, e.RequestID)
+	return append(dst, '\n')
+}
+
+func appendLogfmtValue(dst, value []byte) []byte {
+	quote := len(value) == 0
+	for _, c := range value {
+		if c <= ' ' || c == '=' || c == '"' || c == '\\' || c >= utf8.RuneSelf {
+			quote = true
+			break
+		}
+	}
+	if !quote {
+		return append(dst, value...)
+	}
+	return appendJSONString(dst, value)
+}
+
+// JSONLogFormat formats requests as JSON objects, one per line:
+//
+//	{"time":"2019-03-01T13:55:36Z","method":"GET","path":"/users/1","route":"/users/{id}","status":200,"bytes":42,"latency_ms":0.153,"ip":"127.0.0.1","request_id":"c1"}
+func JSONLogFormat(dst []byte, e *LogEntry) []byte {
+	dst = append(dst, `{"time":"`...)
+	dst = e.Time.AppendFormat(dst, time.RFC3339Nano)
+	dst = append(dst, `","method":`...)
+	dst = appendJSONString(dst, e.Method)
+	dst = append(dst, `,"path":`...)
+	dst = appendJSONString(dst, e.Path)
+	dst = append(dst, `,"route":`...)
+	dst = appendJSONString(dst, e.RoutePattern)
+	dst = append(dst, `,"status":`...)
+	dst = strconv.AppendInt(dst, int64(e.Status), 10)
+	dst = append(dst, `,"bytes":`...)
+	dst = strconv.AppendInt(dst, int64(e.Bytes), 10)
+	dst = append(dst, `,"latency_ms":`...)
+	dst = appendMillis(dst, e.Latency)
+	dst = append(dst, `,"ip":"`...)
+	dst = appendIP(dst, e.RemoteIP)
+	dst = append(dst, `","request_id":`...)
+	dst = appendJSONString(dst, e.RequestID)
+	return append(dst, "}\n"...)
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends `s` as a quoted JSON string, replacing invalid
+// UTF-8 with the replacement character.
+func appendJSONString(dst, s []byte) []byte {
+	dst = append(dst, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				dst = append(dst, '\\', c)
+			case c == '\n':
+				dst = append(dst, '\\', 'n')
+			case c == '\r':
+				dst = append(dst, '\\', 'r')
+			case c == '\t':
+				dst = append(dst, '\\', 't')
+			case c < ' ':
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			default:
+				dst = append(dst, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, "\ufffd"...)
+		} else {
+			dst = append(dst, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(dst, '"')
+}
+
+// ConsoleLogFormat formats requests for reading in a terminal, with the
+// status and latency colorized:
+//
+//	[c1] 13:55:36 GET /users/1 (/users/{id}) from 127.0.0.1 - 200 42B in 153µs
+func ConsoleLogFormat(dst []byte, e *LogEntry) []byte {
+	if len(e.RequestID) > 0 {
+		dst = append(dst, colorYellow...)
+		dst = append(dst, '[')
+		dst = append(dst, e.RequestID...)
+		dst = append(dst, "] "...)
+		dst = append(dst, colorReset...)
+	}
+	dst = e.Time.AppendFormat(dst, "15:04:05 ")
+	dst = append(dst, colorBrightMagenta...)
+	dst = append(dst, e.Method...)
+	dst = append(dst, colorReset...)
+	dst = append(dst, ' ')
+	dst = append(dst, colorCyan...)
+	dst = append(dst, e.Path...)
+	dst = append(dst, colorReset...)
+	if len(e.RoutePattern) > 0 {
+		dst = append(dst, " ("...)
+		dst = append(dst, e.RoutePattern...)
+		dst = append(dst, ')')
+	}
+	dst = append(dst, " from "...)
+	dst = appendIP(dst, e.RemoteIP)
+	dst = append(dst, " - "...)
+
+	switch {
+	case e.Status < 200:
+		dst = append(dst, colorBlue...)
+	case e.Status < 300:
+		dst = append(dst, colorBrightGreen...)
+	case e.Status < 400:
+		dst = append(dst, colorCyan...)
+	case e.Status < 500:
+		dst = append(dst, colorYellow...)
+	default:
+		dst = append(dst, colorBrightRed...)
+	}
+	dst = strconv.AppendInt(dst, int64(e.Status), 10)
+	dst = append(dst, colorReset...)
+	dst = append(dst, ' ')
+	dst = strconv.AppendInt(dst, int64(e.Bytes), 10)
+	dst = append(dst, "B in "...)
+
+	switch {
+	case e.Latency < 500*time.Millisecond:
+		dst = append(dst, colorGreen...)
+	case e.Latency < 5*time.Second:
+		dst = append(dst, colorYellow...)
+	default:
+		dst = append(dst, colorRed...)
+	}
+	dst = appendDuration(dst, e.Latency)
+	dst = append(dst, colorReset...)
+	return append(dst, '\n')
+}
+
+// ANSI escape codes of the console colors
+const (
+	colorRed           = "\033[31m"
+	colorGreen         = "\033[32m"
+	colorYellow        = "\033[33m"
+	colorBlue          = "\033[34m"
+	colorCyan          = "\033[36m"
+	colorBrightRed     = "\033[31;1m"
+	colorBrightGreen   = "\033[32;1m"
+	colorBrightMagenta = "\033[35;1m"
+	colorReset         = "\033[0m"
+)
+
+// appendMillis appends a duration in milliseconds with a microsecond
+// precision.
+func appendMillis(dst []byte, d time.Duration) []byte {
+	return strconv.AppendFloat(dst, float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// appendDuration appends a duration in the unit best suited to read it.
+func appendDuration(dst []byte, d time.Duration) []byte {
+	switch {
+	case d < time.Microsecond:
+		dst = strconv.AppendInt(dst, int64(d), 10)
+		return append(dst, "ns"...)
+	case d < time.Millisecond:
+		dst = strconv.AppendFloat(dst, float64(d)/float64(time.Microsecond), 'f', 0, 64)
+		return append(dst, "µs"...)
+	case d < time.Second:
+		dst = strconv.AppendFloat(dst, float64(d)/float64(time.Millisecond), 'f', 2, 64)
+		return append(dst, "ms"...)
+	default:
+		dst = strconv.AppendFloat(dst, d.Seconds(), 'f', 2, 64)
+		return append(dst, 's')
+	}
+}
+
+// appendIP appends the text form of an IP, without allocating for IPv4.
+func appendIP(dst []byte, ip net.IP) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		for i, b := range ip4 {
+			if i > 0 {
+				dst = append(dst, '.')
+			}
+			dst = strconv.AppendInt(dst, int64(b), 10)
+		}
+		return dst
+	}
+	if len(ip) == 0 {
+		return append(dst, '-')
+	}
+	return append(dst, ip.String()...)
+}
@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+// LogEntry is the record of a request served, as formatted by a LogFormat.
+// Its byte slices refer to the request and response buffers, they're only
+// valid while formatting.
+type LogEntry struct {
+	// Time is when the request started.
+	Time time.Time
+
+	// Method, RequestURI, Path and Proto are the method, the unparsed
+	// URI, the path and the protocol of the request.
+	Method     []byte
+	RequestURI []byte
+	Path       []byte
+	Proto      []byte
+
+	// RoutePattern is the routing pattern matched by the request, as
+	// returned by phi.Context.RoutePattern.
+	RoutePattern []byte
+
+	// Status and Bytes are the status code and the body length of
+	// the response.
+	Status int
+	Bytes  int
+
+	// Latency is the time spent serving the request.
+	Latency time.Duration
+
+	// RemoteIP is the IP of the client.
+	RemoteIP net.IP
+
+	// RequestID is the ID of the request set by the RequestID
+	// middleware, if any.
+	RequestID []byte
+
+	// Referer and UserAgent are the request headers of the same names.
+	Referer   []byte
+	UserAgent []byte
+}
+
+// LogFormat appends a log line for a request, including the trailing
+// newline, to `dst`.
+type LogFormat func(dst []byte, e *LogEntry) []byte
+
+// Logger is a middleware that logs the requests served to os.Stdout in the
+// colorized ConsoleLogFormat, which is meant for development. See
+// RequestLogger for the other formats and writers.
+//
+// Logger should come before any middleware that may change the response,
+// like Recoverer, so that the response logged is the final one.
+func Logger(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+	return defaultLogger(next)
+}
+
+var defaultLogger = RequestLogger(os.Stdout, ConsoleLogFormat)
+
+// RequestLogger returns a middleware that logs the requests served to `w`
+// in `format`, e.g. CombinedLogFormat, LogfmtLogFormat or JSONLogFormat.
+// Log lines are written with a single call to Write, which is serialized.
+func RequestLogger(w io.Writer, format LogFormat) phi.Middleware {
+	l := &logger{w: w, format: format}
+	l.pool.New = func() interface{} {
+		return &logBuffer{buf: make([]byte, 0, 256)}
+	}
+	return l.handler
+}
+
+type logger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format LogFormat
+	pool   sync.Pool
+}
+
+type logBuffer struct {
+	entry LogEntry
+	buf   []byte
+}
+
+func (l *logger) handler(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+	return func(ctx *fasthttp.RequestCtx) {
+		start := time.Now()
+		next(ctx)
+
+		lb := l.pool.Get().(*logBuffer)
+		e := &lb.entry
+		e.Time = start
+		e.Latency = time.Since(start)
+		e.Method = ctx.Method()
+		e.RequestURI = ctx.RequestURI()
+		e.Path = ctx.Path()
+		e.Proto = protoHTTP10
+		if ctx.Request.Header.IsHTTP11() {
+			e.Proto = protoHTTP11
+		}
+		e.Status = ctx.Response.StatusCode()
+		e.Bytes = len(ctx.Response.Body())
+		if ctx.Response.IsBodyStream() {
+			e.Bytes = ctx.Response.Header.ContentLength()
+		}
+		e.RemoteIP = ctx.RemoteIP()
+		e.Referer = ctx.Request.Header.Referer()
+		e.UserAgent = ctx.Request.Header.UserAgent()
+
+		// RoutePattern and RequestID are appended to the buffer to avoid
+		// allocating them, and formatted after them
+		lb.buf = lb.buf[:0]
+		if rctx := routeContext(ctx); rctx != nil {
+			lb.buf = appendRoutePattern(lb.buf, rctx.RoutePatterns)
+		}
+		n := len(lb.buf)
+		lb.buf = append(lb.buf, GetReqID(ctx)...)
+		e.RoutePattern = lb.buf[:n:n]
+		e.RequestID = lb.buf[n:len(lb.buf):len(lb.buf)]
+		n = len(lb.buf)
+		lb.buf = l.format(lb.buf, e)
+
+		l.mu.Lock()
+		l.w.Write(lb.buf[n:])
+		l.mu.Unlock()
+
+		*e = LogEntry{}
+		l.pool.Put(lb)
+	}
+}
+
+var (
+	protoHTTP10 = []byte("HTTP/1.0")
+	protoHTTP11 = []byte("HTTP/1.1")
+)
+
+// appendRoutePattern appends the routing pattern of the request like
+// phi.Context.RoutePattern, which joins the patterns of the sub-routers
+// and drops their "/*" mount wildcards.
+func appendRoutePattern(dst []byte, patterns []string) []byte {
+	start := len(dst)
+	for _, p := range patterns {
+		dst = append(dst, p...)
+	}
+
+	// replace "/*/" with "/", left to right
+	w := start
+	for r := start; r < len(dst); {
+		if r+2 < len(dst) && dst[r] == '/' && dst[r+1] == '*' && dst[r+2] == '/' {
+			dst[w] = '/'
+			w++
+			r += 3
+			continue
+		}
+		dst[w] = dst[r]
+		w++
+		r++
+	}
+	return dst[:w]
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+func TestLogFormats(t *testing.T) {
+	e := &LogEntry{
+		Time:         time.Date(2019, 3, 1, 13, 55, 36, 0, time.UTC),
+		Method:       []byte("GET"),
+		RequestURI:   []byte("/users/1?q=a b"),
+		Path:         []byte("/users/1"),
+		Proto:        []byte("HTTP/1.1"),
+		RoutePattern: []byte("/users/{id}"),
+		Status:       200,
+		Bytes:        42,
+		Latency:      153 * time.Microsecond,
+		RemoteIP:     net.IPv4(127, 0, 0, 1),
+		RequestID:    []byte("c1"),
+		UserAgent:    []byte(`curl "7"`),
+	}
+
+	tests := []struct {
+		name   string
+		format LogFormat
+		line   string
+	}{
+		{"combined", CombinedLogFormat, `127.0.0.1 - - [01/Mar/2019:13:55:36 +0000] "GET /users/1?q=a b HTTP/1.1" 200 42 "-" "curl \"7\""` + "\n"},
+		{"logfmt", LogfmtLogFormat, `time=2019-03-01T13:55:36Z method=GET path=/users/1 route=/users/{id} status=200 bytes=42 latency_ms=0.153 ip=127.0.0.1 request_id=c1` + "\n"},
+		{"json", JSONLogFormat, `{"time":"2019-03-01T13:55:36Z","method":"GET","path":"/users/1","route":"/users/{id}","status":200,"bytes":42,"latency_ms":0.153,"ip":"127.0.0.1","request_id":"c1"}` + "\n"},
+		{"console", ConsoleLogFormat, "\033[33m[c1] \033[0m13:55:36 \033[35;1mGET\033[0m \033[36m/users/1\033[0m (/users/{id}) from 127.0.0.1 - \033[32;1m200\033[0m 42B in \033[32m153µs\033[0m\n"},
+	}
+
+	for _, tt := range tests {
+		if line := string(tt.format(nil, e)); line != tt.line {
+			t.Errorf("%s format expecting:\n%q\ngot:\n%q", tt.name, tt.line, line)
+		}
+	}
+
+	e.Path = []byte("/a \"b\"\n\xff")
+	var v map[string]interface{}
+	if err := json.Unmarshal(JSONLogFormat(nil, e), &v); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if v["path"] != "/a \"b\"\n\ufffd" {
+		t.Errorf("unexpected path: %q", v["path"])
+	}
+	if line := string(LogfmtLogFormat(nil, e)); !strings.Contains(line, ` path="/a \"b\"\n`) {
+		t.Errorf("expecting a quoted logfmt path, got:%s", line)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var w bytes.Buffer
+	r := phi.NewRouter()
+	r.Use(RequestID, RequestLogger(&w, JSONLogFormat))
+	r.Route("/api", func(r phi.Router) {
+		r.Get("/users/{id}", func(ctx *fasthttp.RequestCtx) {
+			ctx.SetStatusCode(201)
+			ctx.WriteString("hello")
+		})
+	})
+
+	ctx := newRequestCtx("GET", "/api/users/1")
+	ctx.Request.Header.Set("X-Request-Id", "abc")
+	r.Handler(ctx)
+
+	var v struct {
+		Method    string `json:"method"`
+		Path      string `json:"path"`
+		Route     string `json:"route"`
+		Status    int    `json:"status"`
+		Bytes     int    `json:"bytes"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(w.Bytes(), &v); err != nil {
+		t.Fatalf("invalid json log %q: %v", w.String(), err)
+	}
+	if v.Method != "GET" || v.Path != "/api/users/1" || v.Route != "/api/users/{id}" ||
+		v.Status != 201 || v.Bytes != 5 || v.RequestID != "abc" {
+		t.Errorf("unexpected log: %s", w.String())
+	}
+}
+
+func TestLoggerAllocs(t *testing.T) {
+	rctx := phi.NewRouteContext()
+	rctx.RoutePatterns = []string{"/api/*", "/users/{id}"}
+	h := RequestLogger(ioutil.Discard, JSONLogFormat)(func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(200)
+	})
+
+	ctx := newRequestCtx("GET", "/api/users/1")
+	ctx.SetUserValue(phi.RouteCtxKey, rctx)
+	h(ctx) // warm up the buffer pool
+
+	if allocs := testing.AllocsPerRun(100, func() { h(ctx) }); allocs > 0 {
+		t.Errorf("expecting no allocations per request, got:%v", allocs)
+	}
+}
@@ -0,0 +1,41 @@
+// Package middleware provides a set of middlewares for phi routers.
+package middleware
+
+import (
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+// routeContext returns the routing context of the request, if any.
+func routeContext(ctx *fasthttp.RequestCtx) *phi.Context {
+	rctx, _ := ctx.UserValue(phi.RouteCtxKey).(*phi.Context)
+	return rctx
+}
+
+// serveError responds to a request with the error handler of its routing
+// Mux, or like the default one of phi, keeping the headers already set.
+func serveError(ctx *fasthttp.RequestCtx, err *phi.HTTPError) {
+	if rctx := routeContext(ctx); rctx != nil {
+		if mux, ok := rctx.Routes.(*phi.Mux); ok {
+			mux.ServeError(ctx, err)
+			return
+		}
+	}
+	msg := err.Message
+	if msg == "" {
+		msg = fasthttp.StatusMessage(err.Status)
+	}
+	ctx.SetStatusCode(err.Status)
+	ctx.SetContentType("text/plain; charset=utf-8")
+	ctx.SetBodyString(msg)
+}
+
+// contextKey is the type of the user value keys set by the middlewares,
+// like the phi contextKey, to prevent collisions with user defined keys.
+type contextKey struct {
+	name string
+}
+
+func (k *contextKey) String() string {
+	return "phi/middleware context key: " + k.name
+}
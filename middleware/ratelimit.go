@@ -0,0 +1,322 @@
+package middleware
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+// ErrRateLimited is the error wrapped by the *phi.HTTPError passed to the
+// error handler of the Mux when a request exceeds its rate limit.
+var ErrRateLimited = errors.New("phi: rate limit exceeded")
+
+// RateLimitResult is the outcome of taking a request from a rate limit.
+type RateLimitResult struct {
+	// Allowed tells whether the request is within the limit.
+	Allowed bool
+
+	// Limit is the number of requests allowed in a row.
+	Limit int
+
+	// Remaining is the number of requests still allowed in a row.
+	Remaining int
+
+	// Reset is the time until the limit is fully available again.
+	Reset time.Duration
+
+	// RetryAfter is the time until the next request is allowed, when
+	// this one isn't.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps the state of the rate limits of the keys, and applies
+// the rate limiting algorithm. Stores backed by a shared database implement
+// the algorithm there, so limits hold across servers.
+type RateLimitStore interface {
+	// Take takes a request from the rate limit of `key` at time `now`.
+	Take(key string, now time.Time) (RateLimitResult, error)
+}
+
+// KeyFunc returns the rate limiting key of a request.
+type KeyFunc func(ctx *fasthttp.RequestCtx) string
+
+// KeyByIP keys the requests by the IP of the client.
+func KeyByIP(ctx *fasthttp.RequestCtx) string {
+	return ctx.RemoteIP().String()
+}
+
+// KeyByHeader keys the requests by the value of a request header, like an
+// API key header.
+func KeyByHeader(name string) KeyFunc {
+	return func(ctx *fasthttp.RequestCtx) string {
+		return string(ctx.Request.Header.Peek(name))
+	}
+}
+
+// KeyByQueryParam keys the requests by the value of a query param, like an
+// API key param.
+func KeyByQueryParam(name string) KeyFunc {
+	return func(ctx *fasthttp.RequestCtx) string {
+		return string(ctx.QueryArgs().Peek(name))
+	}
+}
+
+// KeyByRoutePattern keys the requests by their routing pattern, limiting
+// each route on its own. The pattern is only known once the request is
+// routed, so the middleware must be set on routes with Router.With or
+// Router.Group rather than with Router.Use.
+func KeyByRoutePattern(ctx *fasthttp.RequestCtx) string {
+	if rctx := routeContext(ctx); rctx != nil {
+		return rctx.RoutePattern()
+	}
+	return ""
+}
+
+// KeyBy combines the keys of several KeyFuncs, e.g. to limit each client
+// on each route with KeyBy(KeyByIP, KeyByRoutePattern).
+func KeyBy(fns ...KeyFunc) KeyFunc {
+	return func(ctx *fasthttp.RequestCtx) string {
+		keys := make([]string, len(fns))
+		for i, fn := range fns {
+			keys[i] = fn(ctx)
+		}
+		return strings.Join(keys, "\x00")
+	}
+}
+
+// RateLimit returns a middleware limiting the rate of the requests of each
+// key with a store, like a TokenBucketStore or a SlidingWindowStore. It sets
+// the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers, and
+// responds to the requests over the limit with the error handler of the Mux,
+// with a 429 and a Retry-After header. The errors of the store are handled
+// the same way, with a 500.
+func RateLimit(store RateLimitStore, key KeyFunc) phi.Middleware {
+	return func(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+		return func(ctx *fasthttp.RequestCtx) {
+			res, err := store.Take(key(ctx), time.Now())
+			if err != nil {
+				serveError(ctx, &phi.HTTPError{Status: fasthttp.StatusInternalServerError, Err: err})
+				return
+			}
+			if !res.Allowed {
+				serveError(ctx, &phi.HTTPError{Status: fasthttp.StatusTooManyRequests, Err: ErrRateLimited})
+				ctx.Response.Header.Set("Retry-After", strconv.FormatInt(ceilSeconds(res.RetryAfter), 10))
+				setRateLimitHeaders(ctx, res)
+				return
+			}
+			setRateLimitHeaders(ctx, res)
+			next(ctx)
+		}
+	}
+}
+
+func setRateLimitHeaders(ctx *fasthttp.RequestCtx, res RateLimitResult) {
+	h := &ctx.Response.Header
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(res.Reset), 10))
+}
+
+// ceilSeconds returns a duration in whole seconds, rounded up.
+func ceilSeconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// rateLimitShards is the number of shards of the in-memory stores, which
+// lock each shard on its own.
+const rateLimitShards = 64
+
+// shardIndex returns the shard of a key, by its FNV-1a hash.
+func shardIndex(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % rateLimitShards)
+}
+
+// TokenBucketStore is an in-memory RateLimitStore of token buckets, which
+// allow bursts of requests up to their capacity, and refill at a steady
+// rate.
+type TokenBucketStore struct {
+	capacity int
+	interval time.Duration // time to refill a token
+	shards   [rateLimitShards]tokenBucketShard
+}
+
+type tokenBucketShard struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucketStore returns a TokenBucketStore allowing `rate` requests
+// per `per` duration, in bursts of up to `burst` requests.
+func NewTokenBucketStore(rate int, per time.Duration, burst int) *TokenBucketStore {
+	if rate <= 0 || per <= 0 || burst <= 0 {
+		panic("phi: the rate, period and burst of a token bucket must be positive")
+	}
+	s := &TokenBucketStore{
+		capacity: burst,
+		interval: per / time.Duration(rate),
+	}
+	if s.interval <= 0 {
+		s.interval = 1
+	}
+	for i := range s.shards {
+		s.shards[i].buckets = make(map[string]*tokenBucket)
+	}
+	return s
+}
+
+// Take implements RateLimitStore.
+func (s *TokenBucketStore) Take(key string, now time.Time) (RateLimitResult, error) {
+	sh := &s.shards[shardIndex(key)]
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	// full buckets are dropped once they'd have refilled
+	fill := s.interval * time.Duration(s.capacity)
+	if now.Sub(sh.swept) > fill {
+		for k, b := range sh.buckets {
+			if now.Sub(b.last) >= fill {
+				delete(sh.buckets, k)
+			}
+		}
+		sh.swept = now
+	}
+
+	b := sh.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: float64(s.capacity), last: now}
+		sh.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(s.capacity), b.tokens+float64(elapsed)/float64(s.interval))
+		b.last = now
+	}
+
+	res := RateLimitResult{Limit: s.capacity}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) * float64(s.interval))
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration((float64(s.capacity) - b.tokens) * float64(s.interval))
+	return res, nil
+}
+
+// SlidingWindowStore is an in-memory RateLimitStore allowing a number of
+// requests in any window of time. It approximates the requests of the
+// sliding window from the counts of the current and previous fixed windows,
+// weighting the previous count by its overlap with the sliding window.
+type SlidingWindowStore struct {
+	limit  int
+	window time.Duration
+	shards [rateLimitShards]slidingWindowShard
+}
+
+type slidingWindowShard struct {
+	mu      sync.Mutex
+	windows map[string]*slidingWindow
+	swept   time.Time
+}
+
+type slidingWindow struct {
+	start time.Time // start of the current fixed window
+	prev  int
+	count int
+}
+
+// NewSlidingWindowStore returns a SlidingWindowStore allowing `limit`
+// requests in any `window` of time.
+func NewSlidingWindowStore(limit int, window time.Duration) *SlidingWindowStore {
+	if limit <= 0 || window <= 0 {
+		panic("phi: the limit and window of a sliding window must be positive")
+	}
+	s := &SlidingWindowStore{limit: limit, window: window}
+	for i := range s.shards {
+		s.shards[i].windows = make(map[string]*slidingWindow)
+	}
+	return s
+}
+
+// Take implements RateLimitStore.
+func (s *SlidingWindowStore) Take(key string, now time.Time) (RateLimitResult, error) {
+	sh := &s.shards[shardIndex(key)]
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	// windows are dropped once their counts no longer count
+	if now.Sub(sh.swept) > s.window {
+		for k, w := range sh.windows {
+			if now.Sub(w.start) >= 2*s.window {
+				delete(sh.windows, k)
+			}
+		}
+		sh.swept = now
+	}
+
+	start := now.Truncate(s.window)
+	w := sh.windows[key]
+	if w == nil {
+		w = &slidingWindow{start: start}
+		sh.windows[key] = w
+	}
+	switch {
+	case start.Sub(w.start) >= 2*s.window:
+		w.start, w.prev, w.count = start, 0, 0
+	case start.After(w.start):
+		w.start, w.prev, w.count = start, w.count, 0
+	}
+
+	elapsed := now.Sub(start)
+	weight := float64(s.window-elapsed) / float64(s.window)
+	used := float64(w.prev)*weight + float64(w.count)
+
+	res := RateLimitResult{Limit: s.limit}
+	if used+1 <= float64(s.limit) {
+		w.count++
+		used++
+		res.Allowed = true
+	} else if w.prev > 0 && float64(w.count) < float64(s.limit) {
+		// wait for the previous window to weigh enough less
+		need := (used + 1 - float64(s.limit)) / float64(w.prev)
+		res.RetryAfter = time.Duration(math.Ceil(need * float64(s.window)))
+	} else {
+		// wait for the next window, and then for this one to weigh enough
+		// less as its previous window
+		res.RetryAfter = s.window - elapsed
+		if need := 1 - float64(s.limit-1)/float64(w.count); need > 0 {
+			res.RetryAfter += time.Duration(math.Ceil(need * float64(s.window)))
+		}
+	}
+	res.Remaining = s.limit - int(math.Ceil(used))
+	if res.Remaining < 0 {
+		res.Remaining = 0
+	}
+	res.Reset = s.window - elapsed
+	if w.count > 0 {
+		res.Reset += s.window
+	} else if w.prev == 0 {
+		res.Reset = 0
+	}
+	return res, nil
+}
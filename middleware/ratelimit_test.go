@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+func TestTokenBucketStore(t *testing.T) {
+	s := NewTokenBucketStore(2, time.Second, 3)
+	now := time.Unix(1000, 0)
+
+	tests := []struct {
+		after      time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}{
+		{0, true, 2, 0},
+		{0, true, 1, 0},
+		{0, true, 0, 0},
+		{0, false, 0, 500 * time.Millisecond},
+		{250 * time.Millisecond, false, 0, 250 * time.Millisecond},
+		{250 * time.Millisecond, true, 0, 0},
+		{2 * time.Second, true, 2, 0},
+	}
+	for i, tt := range tests {
+		now = now.Add(tt.after)
+		res, _ := s.Take("k", now)
+		if res.Allowed != tt.allowed || res.Remaining != tt.remaining || res.RetryAfter != tt.retryAfter || res.Limit != 3 {
+			t.Errorf("take %d: unexpected result %+v", i, res)
+		}
+	}
+
+	if res, _ := s.Take("other", now); !res.Allowed || res.Remaining != 2 {
+		t.Errorf("expecting keys to be limited on their own, got:%+v", res)
+	}
+}
+
+func TestSlidingWindowStore(t *testing.T) {
+	s := NewSlidingWindowStore(4, time.Minute)
+	now := time.Unix(6000, 0) // start of a window
+
+	for i := 0; i < 4; i++ {
+		if res, _ := s.Take("k", now); !res.Allowed || res.Remaining != 3-i {
+			t.Fatalf("take %d: unexpected result %+v", i, res)
+		}
+	}
+	// the 4 requests count for 3 a quarter into the next window
+	res, _ := s.Take("k", now.Add(30*time.Second))
+	if res.Allowed || res.RetryAfter != 45*time.Second {
+		t.Errorf("expecting to wait into the next window, got:%+v", res)
+	}
+
+	// half way through the next window, the previous 4 requests count
+	// for 2
+	now = now.Add(90 * time.Second)
+	for i := 0; i < 2; i++ {
+		if res, _ := s.Take("k", now); !res.Allowed {
+			t.Fatalf("take %d: unexpected result %+v", i, res)
+		}
+	}
+	res, _ = s.Take("k", now)
+	if res.Allowed || res.Remaining != 0 || res.RetryAfter != 15*time.Second {
+		t.Errorf("expecting to wait for the previous window to fade, got:%+v", res)
+	}
+
+	res, _ = s.Take("k", now.Add(3*time.Minute))
+	if !res.Allowed || res.Remaining != 3 {
+		t.Errorf("expecting a fresh window, got:%+v", res)
+	}
+}
+
+func TestSlidingWindowStoreRetryAfter(t *testing.T) {
+	for _, limit := range []int{1, 2, 3, 7, 10} {
+		for _, offset := range []time.Duration{0, time.Second, 17 * time.Second, 59 * time.Second} {
+			s := NewSlidingWindowStore(limit, time.Minute)
+			now := time.Unix(6000, 0).Add(offset)
+			for i := 0; i < limit; i++ {
+				s.Take("k", now)
+			}
+
+			// retrying after the reported wait is allowed, but not before
+			for i := 0; i < 3; i++ {
+				res, _ := s.Take("k", now)
+				if res.Allowed || res.RetryAfter <= 0 {
+					t.Fatalf("limit %d offset %s: expecting to wait, got:%+v", limit, offset, res)
+				}
+				if early, _ := s.Take("k", now.Add(res.RetryAfter-time.Millisecond)); early.Allowed {
+					t.Fatalf("limit %d offset %s: expecting a denial before %s", limit, offset, res.RetryAfter)
+				}
+				now = now.Add(res.RetryAfter)
+				if res, _ := s.Take("k", now); !res.Allowed {
+					t.Fatalf("limit %d offset %s: expecting the retry to be allowed, got:%+v", limit, offset, res)
+				}
+			}
+		}
+	}
+}
+
+type errorStore struct{}
+
+func (errorStore) Take(key string, now time.Time) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("store down")
+}
+
+func TestRateLimit(t *testing.T) {
+	r := phi.NewRouter()
+	r.ErrorHandler(func(ctx *fasthttp.RequestCtx, err error) {
+		if e, ok := err.(*phi.HTTPError); ok && e.Err == ErrRateLimited {
+			ctx.Error("slow down", e.Status)
+			return
+		}
+		ctx.Error(err.Error(), 500)
+	})
+	r.Use(RateLimit(NewTokenBucketStore(1, time.Hour, 2), KeyByHeader("X-Api-Key")))
+	r.Get("/", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("ok")
+	})
+	r.With(RateLimit(errorStore{}, KeyByIP)).Get("/down", func(ctx *fasthttp.RequestCtx) {})
+
+	get := func(key string) *fasthttp.RequestCtx {
+		ctx := newRequestCtx("GET", "/")
+		ctx.Request.Header.Set("X-Api-Key", key)
+		r.Handler(ctx)
+		return ctx
+	}
+
+	for i := 0; i < 2; i++ {
+		ctx := get("a")
+		h := &ctx.Response.Header
+		if ctx.Response.StatusCode() != 200 || string(h.Peek("RateLimit-Limit")) != "2" ||
+			string(h.Peek("RateLimit-Remaining")) != strconv.Itoa(1-i) {
+			t.Errorf("request %d: unexpected response\n%s", i, h.String())
+		}
+	}
+	ctx := get("a")
+	h := &ctx.Response.Header
+	if ctx.Response.StatusCode() != 429 || string(ctx.Response.Body()) != "slow down" ||
+		string(h.Peek("Retry-After")) != "3600" || string(h.Peek("RateLimit-Remaining")) != "0" ||
+		string(h.Peek("RateLimit-Reset")) != "7200" {
+		t.Errorf("expecting a 429, got:\n%s", h.String())
+	}
+	if ctx := get("b"); ctx.Response.StatusCode() != 200 {
+		t.Errorf("expecting another key to be allowed, got:%d", ctx.Response.StatusCode())
+	}
+
+	ctx = newRequestCtx("GET", "/down")
+	ctx.Request.Header.Set("X-Api-Key", "c")
+	r.Handler(ctx)
+	if ctx.Response.StatusCode() != 500 || string(ctx.Response.Body()) != "Internal Server Error: store down" {
+		t.Errorf("expecting the store error, got:%d %s", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+}
+
+func TestKeyFuncs(t *testing.T) {
+	r := phi.NewRouter()
+	var key string
+	r.With(func(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+		return func(ctx *fasthttp.RequestCtx) {
+			key = KeyBy(KeyByQueryParam("api_key"), KeyByRoutePattern)(ctx)
+			next(ctx)
+		}
+	}).Get("/users/{id}", func(ctx *fasthttp.RequestCtx) {})
+
+	r.Handler(newRequestCtx("GET", "/users/1?api_key=k1"))
+	if key != "k1\x00/users/{id}" {
+		t.Errorf("unexpected key %q", key)
+	}
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime/debug"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+// ErrAbortHandler is a sentinel panic value to abort a handler. Like
+// http.ErrAbortHandler, which is handled the same way, a panic with it
+// isn't reported by Recoverer, and the response is discarded for an
+// empty 500 closing the connection.
+var ErrAbortHandler = errors.New("phi: abort handler")
+
+// PanicReport describes a panic recovered by Recoverer, or by Timeout once
+// timed out. It's also the error wrapped by the *phi.HTTPError passed to the
+// error handler of the Mux.
+type PanicReport struct {
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+
+	// Method and Path are the method and path of the request.
+	Method string
+	Path   string
+
+	// RoutePattern is the routing pattern matched by the request, if any.
+	RoutePattern string
+
+	// URLParams are the URL params matched by the request.
+	URLParams phi.RouteParams
+
+	// RequestID is the ID of the request set by the RequestID middleware,
+	// if any.
+	RequestID string
+}
+
+func (r *PanicReport) Error() string {
+	return fmt.Sprintf("panic: %v", r.Value)
+}
+
+// PanicReporter reports a panic recovered by Recoverer.
+type PanicReporter func(ctx *fasthttp.RequestCtx, report *PanicReport)
+
+// Recoverer is a middleware that recovers from panics, reports them to
+// os.Stderr along with the request route and stack trace, and responds
+// with the error handler of the routing Mux, which responds with a 500
+// by default.
+//
+// Recoverer should be the first middleware of the stack, so the panics of
+// the other middlewares are recovered as well.
+func Recoverer(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+	return recoverer(next, defaultPanicReporter)
+}
+
+// RecovererWithReporter returns a Recoverer middleware reporting the
+// recovered panics with `reporter`.
+func RecovererWithReporter(reporter PanicReporter) phi.Middleware {
+	return func(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+		return recoverer(next, reporter)
+	}
+}
+
+// PanicWriter returns a PanicReporter writing the reports to `w`.
+func PanicWriter(w io.Writer) PanicReporter {
+	return func(ctx *fasthttp.RequestCtx, report *PanicReport) {
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "panic: %v\n", report.Value)
+		b.WriteString("request: ")
+		if report.RequestID != "" {
+			fmt.Fprintf(&b, "[%s] ", report.RequestID)
+		}
+		fmt.Fprintf(&b, "%s %s", report.Method, report.Path)
+		if report.RoutePattern != "" {
+			fmt.Fprintf(&b, " route: %s", report.RoutePattern)
+		}
+		for i, key := range report.URLParams.Keys {
+			fmt.Fprintf(&b, " %s=%q", key, report.URLParams.Values[i])
+		}
+		b.WriteByte('\n')
+		b.Write(report.Stack)
+		w.Write(b.Bytes())
+	}
+}
+
+var defaultPanicReporter = PanicWriter(os.Stderr)
+
+func recoverer(next phi.RequestHandlerFunc, reporter PanicReporter) phi.RequestHandlerFunc {
+	return func(ctx *fasthttp.RequestCtx) {
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+
+			// Drop the partial response, but not the headers set upstream,
+			// like the request id or the CORS headers
+			ctx.Response.ResetBody()
+			ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+			if rvr == ErrAbortHandler || rvr == http.ErrAbortHandler {
+				ctx.SetConnectionClose()
+				return
+			}
+
+			report := newPanicReport(ctx, rvr, debug.Stack())
+			if reporter != nil {
+				reporter(ctx, report)
+			}
+
+			serveError(ctx, &phi.HTTPError{Status: fasthttp.StatusInternalServerError, Err: report})
+		}()
+
+		next(ctx)
+	}
+}
+
+// newPanicReport returns the report of the panic of a request with `rvr`.
+func newPanicReport(ctx *fasthttp.RequestCtx, rvr interface{}, stack []byte) *PanicReport {
+	report := &PanicReport{
+		Value:  rvr,
+		Stack:  stack,
+		Method: string(ctx.Method()),
+		Path:   string(ctx.Path()),
+
+		RequestID: GetReqID(ctx),
+	}
+	if rctx := routeContext(ctx); rctx != nil {
+		report.RoutePattern = rctx.RoutePattern()
+		report.URLParams.Keys = append([]string(nil), rctx.URLParams.Keys...)
+		report.URLParams.Values = append([]string(nil), rctx.URLParams.Values...)
+	}
+	return report
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+func TestRecoverer(t *testing.T) {
+	var reports []*PanicReport
+	r := phi.NewRouter()
+	r.Use(RequestID, RecovererWithReporter(func(ctx *fasthttp.RequestCtx, report *PanicReport) {
+		reports = append(reports, report)
+	}))
+	r.Get("/users/{id}", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("partial")
+		panic("oops")
+	})
+	r.Get("/abort", func(ctx *fasthttp.RequestCtx) {
+		panic(http.ErrAbortHandler)
+	})
+
+	ctx := newRequestCtx("GET", "/users/42")
+	r.Handler(ctx)
+	if ctx.Response.StatusCode() != 500 || string(ctx.Response.Body()) != "Internal Server Error" {
+		t.Errorf("expecting a 500, got:%d %s", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+	if len(ctx.Response.Header.Peek("X-Request-Id")) == 0 {
+		t.Errorf("expecting the X-Request-Id header to be kept, got:\n%s", ctx.Response.Header.String())
+	}
+	if len(reports) != 1 {
+		t.Fatalf("expecting 1 report, got:%d", len(reports))
+	}
+	report := reports[0]
+	if report.Value != "oops" || report.Method != "GET" || report.Path != "/users/42" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if report.RoutePattern != "/users/{id}" {
+		t.Errorf("expecting route pattern /users/{id}, got:%s", report.RoutePattern)
+	}
+	if len(report.URLParams.Keys) != 1 || report.URLParams.Keys[0] != "id" || report.URLParams.Values[0] != "42" {
+		t.Errorf("unexpected url params: %+v", report.URLParams)
+	}
+	if !bytes.Contains(report.Stack, []byte("recoverer_test.go")) {
+		t.Errorf("expecting the stack trace of the panic, got:%s", report.Stack)
+	}
+
+	ctx = newRequestCtx("GET", "/abort")
+	r.Handler(ctx)
+	if ctx.Response.StatusCode() != 500 || !ctx.Response.ConnectionClose() || len(reports) != 1 {
+		t.Errorf("expecting an unreported abort, got:%d reports:%d", ctx.Response.StatusCode(), len(reports))
+	}
+}
+
+func TestRecovererErrorHandler(t *testing.T) {
+	var w bytes.Buffer
+	r := phi.NewRouter()
+	r.Use(RequestID, RecovererWithReporter(PanicWriter(&w)))
+	r.ErrorHandler(func(ctx *fasthttp.RequestCtx, err error) {
+		report := err.(*phi.HTTPError).Err.(*PanicReport)
+		ctx.Error("recovered: "+report.Error(), 503)
+	})
+	r.Route("/api", func(r phi.Router) {
+		r.Get("/{name}", func(ctx *fasthttp.RequestCtx) {
+			panic("boom")
+		})
+	})
+
+	ctx := newRequestCtx("GET", "/api/x")
+	ctx.Request.Header.Set("X-Request-Id", "abc")
+	r.Handler(ctx)
+	if ctx.Response.StatusCode() != 503 || string(ctx.Response.Body()) != "recovered: panic: boom" {
+		t.Errorf("expecting the error handler response, got:%d %s", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+	if !strings.HasPrefix(w.String(), "panic: boom\nrequest: [abc] GET /api/x route: /api/{name} *=\"x\" name=\"x\"\n") {
+		t.Errorf("unexpected report: %s", w.String())
+	}
+}
+
+func newRequestCtx(method, path string) *fasthttp.RequestCtx {
+	var req fasthttp.Request
+	req.Header.SetMethod(method)
+	req.SetRequestURI(path)
+	req.SetHost("example.com")
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(&req, nil, nil)
+	return ctx
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// RequestIDKey is the user value key of the request ID set by the
+	// RequestID middleware.
+	RequestIDKey = (&contextKey{"RequestID"}).String()
+)
+
+// RequestIDHeader is the header read and echoed by the RequestID middleware.
+var RequestIDHeader = "X-Request-Id"
+
+// RequestID is a middleware that sets the ID of each request. It keeps a
+// valid ID sent in the RequestIDHeader, or generates one with a
+// MonotonicRequestID generator, and echoes it in the response header. The
+// ID is available to the handlers with GetReqID, and is logged by Logger
+// and reported by Recoverer.
+func RequestID(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+	return defaultRequestID(next)
+}
+
+var defaultRequestID = RequestIDWith("", MonotonicRequestID())
+
+// RequestIDWith returns a RequestID middleware reading and echoing the ID in
+// `header`, RequestIDHeader if empty, and generating the missing IDs with
+// `generate`, e.g. MonotonicRequestID() or RandomRequestID.
+func RequestIDWith(header string, generate func() string) phi.Middleware {
+	return func(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+		return func(ctx *fasthttp.RequestCtx) {
+			h := header
+			if h == "" {
+				h = RequestIDHeader
+			}
+			id := ctx.Request.Header.Peek(h)
+			var reqID string
+			if validRequestID(id) {
+				reqID = string(id)
+			} else {
+				reqID = generate()
+			}
+			ctx.SetUserValue(RequestIDKey, reqID)
+			ctx.Response.Header.Set(h, reqID)
+			next(ctx)
+		}
+	}
+}
+
+// GetReqID returns the request ID set by the RequestID middleware, or an
+// empty string.
+func GetReqID(ctx *fasthttp.RequestCtx) string {
+	id, _ := ctx.UserValue(RequestIDKey).(string)
+	return id
+}
+
+// maxRequestIDLen is the maximum length of the request IDs sent by the
+// clients.
+const maxRequestIDLen = 128
+
+// validRequestID reports whether a request ID sent by a client is safe to
+// log and echo: non-empty, not too long, and made of visible ASCII.
+func validRequestID(id []byte) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// MonotonicRequestID returns a generator of IDs made of a prefix unique to
+// the process and a counter, like "host/Xk3bY9aQ2f-000001". They're cheap
+// and sort in order of arrival on a single host.
+func MonotonicRequestID() func() string {
+	hostname, err := os.Hostname()
+	if hostname == "" || err != nil {
+		hostname = "localhost"
+	}
+	var buf [12]byte
+	var b64 string
+	for len(b64) < 10 {
+		rand.Read(buf[:])
+		b64 = base64.StdEncoding.EncodeToString(buf[:])
+		b64 = strings.NewReplacer("+", "", "/", "").Replace(b64)
+	}
+	prefix := hostname + "/" + b64[:10] + "-"
+
+	var counter uint64
+	return func() string {
+		n := atomic.AddUint64(&counter, 1)
+		var nb [20]byte
+		s := strconv.AppendUint(nb[:0], n, 10)
+		b := make([]byte, 0, len(prefix)+len(s)+6)
+		b = append(b, prefix...)
+		for i := len(s); i < 6; i++ {
+			b = append(b, '0')
+		}
+		return string(append(b, s...))
+	}
+}
+
+// RandomRequestID generates random IDs of 32 hex digits, which are unique
+// across hosts without coordination.
+func RandomRequestID() string {
+	var buf [16]byte
+	rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+func TestRequestID(t *testing.T) {
+	r := phi.NewRouter()
+	r.Use(RequestID)
+	r.Get("/", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString(GetReqID(ctx))
+	})
+
+	monotonic := regexp.MustCompile(`^[^/]+/[0-9A-Za-z]{10}-(\d{6,})$`)
+	var prev string
+	for i := 0; i < 2; i++ {
+		ctx := newRequestCtx("GET", "/")
+		r.Handler(ctx)
+		id := string(ctx.Response.Body())
+		m := monotonic.FindStringSubmatch(id)
+		if m == nil || string(ctx.Response.Header.Peek("X-Request-Id")) != id {
+			t.Fatalf("expecting a monotonic id echoed in the response, got:%q", id)
+		}
+		if m[1] <= prev {
+			t.Errorf("expecting increasing ids, got:%s after %s", m[1], prev)
+		}
+		prev = m[1]
+	}
+
+	tests := []struct {
+		header string
+		keep   bool
+	}{
+		{"abc-123", true},
+		{"", false},
+		{"a b", false},
+		{"caf\xc3\xa9", false},
+		{string(make([]byte, maxRequestIDLen+1)), false},
+	}
+	for _, tt := range tests {
+		ctx := newRequestCtx("GET", "/")
+		ctx.Request.Header.Set("X-Request-Id", tt.header)
+		r.Handler(ctx)
+		if id := string(ctx.Response.Body()); (id == tt.header) != tt.keep || id == "" {
+			t.Errorf("header %q: unexpected id %q", tt.header, id)
+		}
+	}
+}
+
+func TestRequestIDWith(t *testing.T) {
+	r := phi.NewRouter()
+	r.Use(RequestIDWith("X-Trace-Id", RandomRequestID))
+	r.Get("/", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString(GetReqID(ctx))
+	})
+
+	ctx := newRequestCtx("GET", "/")
+	r.Handler(ctx)
+	id := string(ctx.Response.Body())
+	if !regexp.MustCompile(`^[0-9a-f]{32}$`).MatchString(id) || string(ctx.Response.Header.Peek("X-Trace-Id")) != id {
+		t.Errorf("expecting a random id echoed in the response, got:%q", id)
+	}
+
+	if id := GetReqID(newRequestCtx("GET", "/")); id != "" {
+		t.Errorf("expecting no id without the middleware, got:%q", id)
+	}
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// CSPNonceKey is the user value key of the Content-Security-Policy
+	// nonce of the request, set by the SecurityHeaders middleware.
+	CSPNonceKey = (&contextKey{"CSPNonce"}).String()
+)
+
+// CSPNoncePlaceholder is replaced with the nonce of each request in the
+// Content-Security-Policy of SecurityHeadersOptions.
+const CSPNoncePlaceholder = "{nonce}"
+
+// SecurityHeadersOptions are the security headers set by SecurityHeaders.
+// The headers of empty options aren't sent.
+type SecurityHeadersOptions struct {
+	// HSTSMaxAge is the max-age of Strict-Transport-Security in seconds,
+	// and HSTSIncludeSubdomains and HSTSPreload its directives of the
+	// same names.
+	HSTSMaxAge            int
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	// ContentSecurityPolicy is the Content-Security-Policy. Its
+	// CSPNoncePlaceholders are replaced with a nonce generated for each
+	// request, like in "script-src 'nonce-{nonce}'", which the handlers
+	// get with CSPNonce.
+	ContentSecurityPolicy string
+
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only.
+	CSPReportOnly bool
+
+	// ContentTypeNosniff sets X-Content-Type-Options to "nosniff".
+	ContentTypeNosniff bool
+
+	// ReferrerPolicy is the Referrer-Policy, like "no-referrer".
+	ReferrerPolicy string
+
+	// PermissionsPolicy is the Permissions-Policy, like "camera=()".
+	PermissionsPolicy string
+
+	// FrameOptions is the X-Frame-Options, "DENY" or "SAMEORIGIN".
+	FrameOptions string
+
+	// CrossOriginOpenerPolicy and CrossOriginEmbedderPolicy are the
+	// Cross-Origin-Opener-Policy and Cross-Origin-Embedder-Policy.
+	CrossOriginOpenerPolicy   string
+	CrossOriginEmbedderPolicy string
+}
+
+// StrictAPIHeaders returns the security headers of an API serving no
+// documents: nothing may be loaded, framed or sniffed from its responses.
+func StrictAPIHeaders() SecurityHeadersOptions {
+	return SecurityHeadersOptions{
+		HSTSMaxAge:                63072000,
+		HSTSIncludeSubdomains:     true,
+		ContentSecurityPolicy:     "default-src 'none'; frame-ancestors 'none'",
+		ContentTypeNosniff:        true,
+		ReferrerPolicy:            "no-referrer",
+		PermissionsPolicy:         "accelerometer=(), camera=(), geolocation=(), gyroscope=(), microphone=(), payment=(), usb=()",
+		FrameOptions:              "DENY",
+		CrossOriginOpenerPolicy:   "same-origin",
+		CrossOriginEmbedderPolicy: "require-corp",
+	}
+}
+
+// WebAppHeaders returns the security headers of a web app serving its
+// documents and assets from its own origin, with the inline scripts and
+// styles allowed by the nonce of CSPNonce.
+func WebAppHeaders() SecurityHeadersOptions {
+	return SecurityHeadersOptions{
+		HSTSMaxAge:              63072000,
+		HSTSIncludeSubdomains:   true,
+		ContentSecurityPolicy:   "default-src 'self'; script-src 'self' 'nonce-{nonce}'; style-src 'self' 'nonce-{nonce}'; img-src 'self' data:; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'self'",
+		ContentTypeNosniff:      true,
+		ReferrerPolicy:          "strict-origin-when-cross-origin",
+		PermissionsPolicy:       "camera=(), geolocation=(), microphone=(), payment=()",
+		FrameOptions:            "SAMEORIGIN",
+		CrossOriginOpenerPolicy: "same-origin",
+	}
+}
+
+// SecurityHeaders returns a middleware setting the security headers of
+// `opts` on the responses, before calling the handlers so they may change
+// them. A SecurityHeaders used on a group of routes, e.g. with Router.With,
+// overrides the headers of those used before it: the headers of its empty
+// options are removed.
+func SecurityHeaders(opts SecurityHeadersOptions) phi.Middleware {
+	var headers [][2]string
+	add := func(name, value string) {
+		headers = append(headers, [2]string{name, value})
+	}
+
+	var hsts string
+	if opts.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(opts.HSTSMaxAge)
+		if opts.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if opts.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+	add("Strict-Transport-Security", hsts)
+	var nosniff string
+	if opts.ContentTypeNosniff {
+		nosniff = "nosniff"
+	}
+	add("X-Content-Type-Options", nosniff)
+	add("Referrer-Policy", opts.ReferrerPolicy)
+	add("Permissions-Policy", opts.PermissionsPolicy)
+	add("X-Frame-Options", opts.FrameOptions)
+	add("Cross-Origin-Opener-Policy", opts.CrossOriginOpenerPolicy)
+	add("Cross-Origin-Embedder-Policy", opts.CrossOriginEmbedderPolicy)
+
+	cspHeader, otherCSPHeader := "Content-Security-Policy", "Content-Security-Policy-Report-Only"
+	if opts.CSPReportOnly {
+		cspHeader, otherCSPHeader = otherCSPHeader, cspHeader
+	}
+	csp := strings.Split(opts.ContentSecurityPolicy, CSPNoncePlaceholder)
+
+	return func(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+		return func(ctx *fasthttp.RequestCtx) {
+			h := &ctx.Response.Header
+			for _, hv := range headers {
+				if hv[1] == "" {
+					h.Del(hv[0])
+				} else {
+					h.Set(hv[0], hv[1])
+				}
+			}
+
+			h.Del(otherCSPHeader)
+			switch {
+			case opts.ContentSecurityPolicy == "":
+				h.Del(cspHeader)
+				ctx.SetUserValue(CSPNonceKey, nil)
+			case len(csp) == 1:
+				h.Set(cspHeader, opts.ContentSecurityPolicy)
+				ctx.SetUserValue(CSPNonceKey, nil)
+			default:
+				nonce := newCSPNonce()
+				ctx.SetUserValue(CSPNonceKey, nonce)
+				h.Set(cspHeader, strings.Join(csp, nonce))
+			}
+			next(ctx)
+		}
+	}
+}
+
+// CSPNonce returns the Content-Security-Policy nonce of the request, to
+// render in the nonce attribute of its inline scripts and styles.
+func CSPNonce(ctx *fasthttp.RequestCtx) string {
+	nonce, _ := ctx.UserValue(CSPNonceKey).(string)
+	return nonce
+}
+
+func newCSPNonce() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("phi: failed to generate a CSP nonce: " + err.Error())
+	}
+	return base64.StdEncoding.EncodeToString(b[:])
+}
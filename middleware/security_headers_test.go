@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	r := phi.NewRouter()
+	r.Use(SecurityHeaders(WebAppHeaders()))
+	r.Get("/", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString(CSPNonce(ctx))
+	})
+
+	api := StrictAPIHeaders()
+	api.HSTSPreload = true
+	r.With(SecurityHeaders(api)).Get("/api", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString(CSPNonce(ctx))
+	})
+
+	embed := WebAppHeaders()
+	embed.FrameOptions = ""
+	embed.CSPReportOnly = true
+	r.With(SecurityHeaders(embed)).Get("/embed", func(ctx *fasthttp.RequestCtx) {})
+
+	ctx := newRequestCtx("GET", "/")
+	r.Handler(ctx)
+	h := &ctx.Response.Header
+	nonce := string(ctx.Response.Body())
+	if !regexp.MustCompile(`^[A-Za-z0-9+/]{22}==$`).MatchString(nonce) {
+		t.Fatalf("expecting a nonce, got:%q", nonce)
+	}
+	expected := map[string]string{
+		"Strict-Transport-Security":  "max-age=63072000; includeSubDomains",
+		"Content-Security-Policy":    "default-src 'self'; script-src 'self' 'nonce-" + nonce + "'; style-src 'self' 'nonce-" + nonce + "'; img-src 'self' data:; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'self'",
+		"X-Content-Type-Options":     "nosniff",
+		"Referrer-Policy":            "strict-origin-when-cross-origin",
+		"X-Frame-Options":            "SAMEORIGIN",
+		"Cross-Origin-Opener-Policy": "same-origin",
+	}
+	for name, value := range expected {
+		if v := string(h.Peek(name)); v != value {
+			t.Errorf("%s: expecting %q, got:%q", name, value, v)
+		}
+	}
+
+	ctx = newRequestCtx("GET", "/")
+	r.Handler(ctx)
+	if string(ctx.Response.Body()) == nonce {
+		t.Errorf("expecting a nonce per request")
+	}
+
+	ctx = newRequestCtx("GET", "/api")
+	r.Handler(ctx)
+	h = &ctx.Response.Header
+	if string(h.Peek("Strict-Transport-Security")) != "max-age=63072000; includeSubDomains; preload" ||
+		string(h.Peek("Content-Security-Policy")) != "default-src 'none'; frame-ancestors 'none'" ||
+		string(h.Peek("Cross-Origin-Embedder-Policy")) != "require-corp" ||
+		string(h.Peek("X-Frame-Options")) != "DENY" || len(ctx.Response.Body()) > 0 {
+		t.Errorf("expecting the group headers to override the others, got:\n%s", h.String())
+	}
+
+	ctx = newRequestCtx("GET", "/embed")
+	r.Handler(ctx)
+	h = &ctx.Response.Header
+	if len(h.Peek("X-Frame-Options")) > 0 || len(h.Peek("Content-Security-Policy")) > 0 ||
+		len(h.Peek("Content-Security-Policy-Report-Only")) == 0 {
+		t.Errorf("expecting the empty options to remove the headers, got:\n%s", h.String())
+	}
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+// ErrThrottled is the error wrapped by the *phi.HTTPError passed to the
+// error handler of the Mux when a request is turned away by Throttle.
+var ErrThrottled = errors.New("phi: server capacity exceeded")
+
+// ThrottleOpts configures the Throttle middleware.
+type ThrottleOpts struct {
+	// Limit is the number of requests processed at once.
+	Limit int
+
+	// BacklogLimit is the number of requests waiting to be processed,
+	// none if zero.
+	BacklogLimit int
+
+	// BacklogTimeout is the time a request waits in the backlog, 60
+	// seconds if zero.
+	BacklogTimeout time.Duration
+
+	// RetryAfter is sent in the Retry-After header of the requests turned
+	// away, the backlog timeout or a second if zero.
+	RetryAfter time.Duration
+}
+
+const defaultBacklogTimeout = 60 * time.Second
+
+// Throttle is a middleware that limits the number of requests processed at
+// once, and turns away the others with a 503. Used in a Route or Group, it
+// gives expensive routes limits of their own.
+func Throttle(limit int) phi.Middleware {
+	return ThrottleWithOpts(ThrottleOpts{Limit: limit})
+}
+
+// ThrottleBacklog is a middleware that limits the number of requests
+// processed at once, and lets up to `backlogLimit` requests wait for at
+// most `backlogTimeout` to be processed before turning them away.
+func ThrottleBacklog(limit, backlogLimit int, backlogTimeout time.Duration) phi.Middleware {
+	return ThrottleWithOpts(ThrottleOpts{Limit: limit, BacklogLimit: backlogLimit, BacklogTimeout: backlogTimeout})
+}
+
+// ThrottleWithOpts returns a Throttle middleware configured with `opts`.
+// The requests turned away are responded to with the error handler of the
+// Mux, with a 503 and a Retry-After header.
+func ThrottleWithOpts(opts ThrottleOpts) phi.Middleware {
+	return newThrottler(opts).handler
+}
+
+func newThrottler(opts ThrottleOpts) *throttler {
+	if opts.Limit < 1 {
+		panic("phi: throttle expects limit > 0")
+	}
+	if opts.BacklogLimit < 0 {
+		panic("phi: throttle expects backlogLimit to be positive")
+	}
+	if opts.BacklogTimeout <= 0 {
+		opts.BacklogTimeout = defaultBacklogTimeout
+	}
+	retryAfter := opts.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = time.Second
+		if opts.BacklogLimit > 0 {
+			retryAfter = opts.BacklogTimeout
+		}
+	}
+
+	t := &throttler{
+		tokens:         make(chan struct{}, opts.Limit),
+		backlogTokens:  make(chan struct{}, opts.Limit+opts.BacklogLimit),
+		backlogTimeout: opts.BacklogTimeout,
+		retryAfter:     strconv.FormatInt(ceilSeconds(retryAfter), 10),
+	}
+	for i := 0; i < opts.Limit; i++ {
+		t.tokens <- struct{}{}
+	}
+	for i := 0; i < opts.Limit+opts.BacklogLimit; i++ {
+		t.backlogTokens <- struct{}{}
+	}
+	return t
+}
+
+// throttler holds a token per request processed at once, and a backlog
+// token per request processed or waiting.
+type throttler struct {
+	tokens         chan struct{}
+	backlogTokens  chan struct{}
+	backlogTimeout time.Duration
+	retryAfter     string
+}
+
+func (t *throttler) handler(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+	return func(ctx *fasthttp.RequestCtx) {
+		select {
+		case btok := <-t.backlogTokens:
+			defer func() {
+				t.backlogTokens <- btok
+			}()
+		default:
+			t.reject(ctx)
+			return
+		}
+
+		select {
+		case tok := <-t.tokens:
+			defer func() {
+				t.tokens <- tok
+			}()
+			next(ctx)
+			return
+		default:
+		}
+
+		timer := time.NewTimer(t.backlogTimeout)
+		defer timer.Stop()
+		select {
+		case tok := <-t.tokens:
+			defer func() {
+				t.tokens <- tok
+			}()
+			next(ctx)
+		case <-timer.C:
+			t.reject(ctx)
+		}
+	}
+}
+
+func (t *throttler) reject(ctx *fasthttp.RequestCtx) {
+	serveError(ctx, &phi.HTTPError{Status: fasthttp.StatusServiceUnavailable, Err: ErrThrottled})
+	ctx.Response.Header.Set("Retry-After", t.retryAfter)
+}
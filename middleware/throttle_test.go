@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+func TestThrottle(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	throttler := newThrottler(ThrottleOpts{Limit: 1, BacklogLimit: 1, BacklogTimeout: time.Minute})
+
+	r := phi.NewRouter()
+	r.Route("/slow", func(r phi.Router) {
+		r.Use(throttler.handler)
+		r.Get("/", func(ctx *fasthttp.RequestCtx) {
+			started <- struct{}{}
+			<-release
+			ctx.WriteString("done")
+		})
+	})
+	r.Get("/fast", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("fast")
+	})
+
+	var wg sync.WaitGroup
+	statuses := make([]int, 2)
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := newRequestCtx("GET", "/slow")
+			r.Handler(ctx)
+			statuses[i] = ctx.Response.StatusCode()
+		}(i)
+		if i == 0 {
+			<-started
+		}
+	}
+	// wait for the second request to take the last backlog token
+	for deadline := time.Now().Add(5 * time.Second); len(throttler.backlogTokens) > 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expecting the second request to be backlogged")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the processed and the backlogged requests use up the capacity
+	ctx := newRequestCtx("GET", "/slow")
+	r.Handler(ctx)
+	if ctx.Response.StatusCode() != 503 || string(ctx.Response.Header.Peek("Retry-After")) != "60" {
+		t.Errorf("expecting a 503, got:%d\n%s", ctx.Response.StatusCode(), ctx.Response.Header.String())
+	}
+
+	// other routes aren't throttled
+	ctx = newRequestCtx("GET", "/fast")
+	r.Handler(ctx)
+	if string(ctx.Response.Body()) != "fast" {
+		t.Errorf("expecting the fast route to be served, got:%s", ctx.Response.Body())
+	}
+
+	close(release)
+	wg.Wait()
+	if statuses[0] != 200 || statuses[1] != 200 {
+		t.Errorf("expecting the processed and backlogged requests to be served, got:%v", statuses)
+	}
+}
+
+func TestThrottleBacklogTimeout(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	r := phi.NewRouter()
+	r.Use(ThrottleWithOpts(ThrottleOpts{Limit: 1, BacklogLimit: 1, BacklogTimeout: 10 * time.Millisecond, RetryAfter: 5 * time.Second}))
+	r.Get("/", func(ctx *fasthttp.RequestCtx) {
+		close(started)
+		<-release
+	})
+
+	done := make(chan struct{})
+	go func() {
+		r.Handler(newRequestCtx("GET", "/"))
+		close(done)
+	}()
+	<-started
+
+	ctx := newRequestCtx("GET", "/")
+	r.Handler(ctx)
+	if ctx.Response.StatusCode() != 503 || string(ctx.Response.Header.Peek("Retry-After")) != "5" {
+		t.Errorf("expecting the backlogged request to time out, got:%d\n%s", ctx.Response.StatusCode(), ctx.Response.Header.String())
+	}
+	close(release)
+	<-done
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+// ErrHandlerTimeout is the error wrapped by the *phi.HTTPError passed to the
+// error handler of the Mux when a request times out.
+var ErrHandlerTimeout = errors.New("phi: handler timeout")
+
+var (
+	// DeadlineKey is the user value key of the deadline set by the
+	// Timeout middleware.
+	DeadlineKey = (&contextKey{"Deadline"}).String()
+)
+
+// Timeout is a middleware that gives the handlers `timeout` to respond,
+// and then responds with the error handler of the Mux with a 504, or with
+// a 503 when the deadline of an outer Timeout has already passed. Used in
+// a Route or Group, it sets the deadline of a group of routes.
+//
+// The handlers keep on running once timed out, they should give up when
+// the context of DeadlineContext is done. They're run in a goroutine of
+// their own with a copy of the request context, so that they never write
+// to the request context once its response is sent, and their panics are
+// recovered by Recoverer as usual unless they happen after the timeout.
+// Those are passed to the error handler of the Mux with the copy of the
+// request context, whose response is dropped, wrapping a *PanicReport with
+// a 500, for it to log them. The copy of the request context isn't bound to
+// the connection, so the handlers can't hijack it.
+func Timeout(timeout time.Duration) phi.Middleware {
+	return func(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+		return func(ctx *fasthttp.RequestCtx) {
+			parent := DeadlineContext(ctx)
+			if parent.Err() != nil {
+				serveError(ctx, &phi.HTTPError{Status: fasthttp.StatusServiceUnavailable, Err: ErrHandlerTimeout})
+				return
+			}
+			dctx, cancel := context.WithTimeout(parent, timeout)
+			defer cancel()
+
+			tctx := shadowRequestCtx(ctx)
+			tctx.SetUserValue(DeadlineKey, dctx)
+
+			done := make(chan *PanicReport, 1)
+			go func() {
+				defer func() {
+					var report *PanicReport
+					if rvr := recover(); rvr != nil {
+						report = &PanicReport{Value: rvr, Stack: debug.Stack()}
+					}
+					done <- report
+				}()
+				next(tctx)
+			}()
+
+			select {
+			case report := <-done:
+				if report != nil {
+					panic(report.Value)
+				}
+				copyShadowRequestCtx(ctx, tctx)
+			case <-dctx.Done():
+				serveError(ctx, &phi.HTTPError{Status: fasthttp.StatusGatewayTimeout, Err: ErrHandlerTimeout})
+				go serveLatePanic(tctx, done)
+			}
+		}
+	}
+}
+
+// serveLatePanic passes the panic of a handler after its timeout, if any,
+// to the error handler of the Mux with the copy of the request context it
+// ran with.
+func serveLatePanic(tctx *fasthttp.RequestCtx, done <-chan *PanicReport) {
+	report := <-done
+	if report == nil || report.Value == ErrAbortHandler || report.Value == http.ErrAbortHandler {
+		return
+	}
+	serveError(tctx, &phi.HTTPError{
+		Status: fasthttp.StatusInternalServerError,
+		Err:    newPanicReport(tctx, report.Value, report.Stack),
+	})
+}
+
+// GetDeadline returns the deadline of the request set by the Timeout
+// middleware, if any.
+func GetDeadline(ctx *fasthttp.RequestCtx) (time.Time, bool) {
+	if dctx, ok := ctx.UserValue(DeadlineKey).(context.Context); ok {
+		return dctx.Deadline()
+	}
+	return time.Time{}, false
+}
+
+// DeadlineContext returns a context.Context done once the request set by
+// the Timeout middleware times out, to cancel the work done on behalf of
+// the request. Without the middleware, it's never done.
+func DeadlineContext(ctx *fasthttp.RequestCtx) context.Context {
+	if dctx, ok := ctx.UserValue(DeadlineKey).(context.Context); ok {
+		return dctx
+	}
+	return context.Background()
+}
+
+// shadowRequestCtx returns a copy of a request context with the request and
+// the user values, and a clone of the routing context.
+func shadowRequestCtx(ctx *fasthttp.RequestCtx) *fasthttp.RequestCtx {
+	tctx := &fasthttp.RequestCtx{}
+	tctx.Init(&ctx.Request, ctx.RemoteAddr(), ctx.Logger())
+	ctx.VisitUserValues(func(key []byte, value interface{}) {
+		if rctx, ok := value.(*phi.Context); ok {
+			value = rctx.Clone()
+		}
+		tctx.SetUserValueBytes(key, value)
+	})
+	ctx.Response.CopyTo(&tctx.Response)
+	return tctx
+}
+
+// copyShadowRequestCtx copies the response and the user values of the copy
+// of a request context back to it, but the deadline.
+func copyShadowRequestCtx(ctx, tctx *fasthttp.RequestCtx) {
+	tctx.VisitUserValues(func(key []byte, value interface{}) {
+		if string(key) == DeadlineKey {
+			return
+		}
+		if trctx, ok := value.(*phi.Context); ok {
+			if rctx, ok := ctx.UserValueBytes(key).(*phi.Context); ok {
+				*rctx = *trctx
+				return
+			}
+		}
+		ctx.SetUserValueBytes(key, value)
+	})
+
+	if !tctx.Response.IsBodyStream() {
+		tctx.Response.CopyTo(&ctx.Response)
+		return
+	}
+	tctx.Response.Header.CopyTo(&ctx.Response.Header)
+	ctx.Response.SetBodyStreamWriter(func(w *bufio.Writer) {
+		tctx.Response.BodyWriteTo(w)
+	})
+}
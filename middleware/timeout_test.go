@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tsingson/phi"
+	"github.com/valyala/fasthttp"
+)
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	r := phi.NewRouter()
+	r.Use(RequestID)
+	r.Route("/reports", func(r phi.Router) {
+		r.Use(Timeout(20 * time.Millisecond))
+		r.Get("/{id}", func(ctx *fasthttp.RequestCtx) {
+			deadline, ok := GetDeadline(ctx)
+			if !ok || time.Until(deadline) > 20*time.Millisecond {
+				t.Errorf("expecting the deadline of the route, got:%v %v", deadline, ok)
+			}
+			ctx.SetUserValue("report", phi.URLParam(ctx, "id"))
+			ctx.SetContentType("text/csv")
+			ctx.WriteString("report " + phi.URLParam(ctx, "id"))
+		})
+		r.Get("/slow", func(ctx *fasthttp.RequestCtx) {
+			select {
+			case <-DeadlineContext(ctx).Done():
+			case <-release:
+			}
+			ctx.WriteString("too late")
+		})
+		r.Get("/panic", func(ctx *fasthttp.RequestCtx) {
+			panic("boom")
+		})
+	})
+
+	var pattern string
+	handler := r.Handler
+	h := func(ctx *fasthttp.RequestCtx) {
+		handler(ctx)
+		pattern = routeContext(ctx).RoutePattern()
+	}
+
+	ctx := newRequestCtx("GET", "/reports/42")
+	h(ctx)
+	if ctx.Response.StatusCode() != 200 || string(ctx.Response.Body()) != "report 42" ||
+		string(ctx.Response.Header.ContentType()) != "text/csv" || ctx.UserValue("report") != "42" {
+		t.Errorf("expecting the report, got:%d %s", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+	if pattern != "/reports/{id}" || len(ctx.Response.Header.Peek("X-Request-Id")) == 0 {
+		t.Errorf("expecting the routing context and the headers set before the timeout, got:%q", pattern)
+	}
+	if _, ok := GetDeadline(ctx); ok {
+		t.Errorf("expecting no deadline outside of the route")
+	}
+
+	ctx = newRequestCtx("GET", "/reports/slow")
+	h(ctx)
+	if ctx.Response.StatusCode() != 504 || string(ctx.Response.Body()) != "Gateway Timeout" {
+		t.Errorf("expecting a 504, got:%d %s", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	func() {
+		defer func() {
+			if rvr := recover(); rvr != "boom" {
+				t.Errorf("expecting the panic of the handler, got:%v", rvr)
+			}
+		}()
+		r.Handler(newRequestCtx("GET", "/reports/panic"))
+	}()
+}
+
+func TestTimeoutLatePanic(t *testing.T) {
+	errs := make(chan error, 1)
+	r := phi.NewRouter()
+	r.Use(RequestID, Timeout(10*time.Millisecond))
+	r.ErrorHandler(func(ctx *fasthttp.RequestCtx, err error) {
+		if err.(*phi.HTTPError).Status == 500 {
+			errs <- err
+		}
+		ctx.Error(err.Error(), err.(*phi.HTTPError).Status)
+	})
+	r.Get("/{id}", func(ctx *fasthttp.RequestCtx) {
+		<-DeadlineContext(ctx).Done()
+		panic("too late")
+	})
+
+	ctx := newRequestCtx("GET", "/42")
+	r.Handler(ctx)
+	if ctx.Response.StatusCode() != 504 {
+		t.Errorf("expecting a 504, got:%d", ctx.Response.StatusCode())
+	}
+
+	select {
+	case err := <-errs:
+		report, ok := err.(*phi.HTTPError).Err.(*PanicReport)
+		if !ok || report.Value != "too late" || report.RoutePattern != "/{id}" || report.RequestID == "" {
+			t.Errorf("expecting the report of the late panic, got:%+v", err.(*phi.HTTPError).Err)
+		}
+		if !bytes.Contains(report.Stack, []byte("timeout_test.go")) {
+			t.Errorf("expecting the stack trace of the panic, got:%s", report.Stack)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expecting the late panic to be passed to the error handler")
+	}
+}
+
+func TestTimeoutNested(t *testing.T) {
+	r := phi.NewRouter()
+	r.Use(Timeout(time.Hour))
+	r.ErrorHandler(func(ctx *fasthttp.RequestCtx, err error) {
+		ctx.Error("timed out: "+err.Error(), err.(*phi.HTTPError).Status)
+	})
+	r.With(Timeout(time.Minute)).Get("/", func(ctx *fasthttp.RequestCtx) {
+		deadline, _ := GetDeadline(ctx)
+		if time.Until(deadline) > time.Minute {
+			t.Errorf("expecting the nearest deadline, got:%v", deadline)
+		}
+	})
+	r.With(func(next phi.RequestHandlerFunc) phi.RequestHandlerFunc {
+		return func(ctx *fasthttp.RequestCtx) {
+			// the request waited past its deadline, e.g. in a backlog
+			dctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			ctx.SetUserValue(DeadlineKey, dctx)
+			next(ctx)
+		}
+	}).With(Timeout(time.Second)).Get("/late", func(ctx *fasthttp.RequestCtx) {
+		t.Errorf("expecting the late request not to be handled")
+	})
+
+	ctx := newRequestCtx("GET", "/")
+	r.Handler(ctx)
+	if ctx.Response.StatusCode() != 200 {
+		t.Errorf("expecting a 200, got:%d", ctx.Response.StatusCode())
+	}
+
+	ctx = newRequestCtx("GET", "/late")
+	r.Handler(ctx)
+	if ctx.Response.StatusCode() != 503 || string(ctx.Response.Body()) != "timed out: Service Unavailable: phi: handler timeout" {
+		t.Errorf("expecting a 503, got:%d %s", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+}
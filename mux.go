@@ -2,8 +2,11 @@ package phi
 
 import (
 	"fmt"
+	"net/url"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/valyala/fasthttp"
@@ -20,9 +23,16 @@ var _ Router = &Mux{}
 // particularly useful for writing large REST API services that break a handler
 // into many smaller parts composed of middlewares and end handlers.
 type Mux struct {
-	// The radix trie router
+	// The radix trie router routes are registered on
 	tree *node
 
+	// The radix trie router served to requests, a *node swapped
+	// atomically by Update
+	live atomic.Value
+
+	// Serializes the updates of the routing tree
+	updateMu sync.Mutex
+
 	// The middleware stack
 	middlewares Middlewares
 
@@ -43,12 +53,60 @@ type Mux struct {
 
 	// Custom method not allowed handler
 	methodNotAllowedHandler RequestHandlerFunc
+
+	// Custom handler of the errors returned by ErrorHandlerFunc routes
+	errorHandler func(ctx *fasthttp.RequestCtx, err error)
+
+	// Sub-routers matched against the request host, which host routers
+	// are registered on
+	hosts []*hostRoute
+
+	// The host routers served to requests, a []*hostRoute swapped
+	// atomically by Host and Update
+	liveHosts atomic.Value
+
+	// RedirectTrailingSlash enables automatic redirection if the current
+	// route can't be matched but a route for the path with (without) the
+	// trailing slash exists. For example if /foo/ is requested but a route
+	// only exists for /foo, the client is redirected to /foo with status
+	// code 301 for GET/HEAD requests and 308 for all other request methods.
+	RedirectTrailingSlash bool
+
+	// RedirectFixedPath enables automatic redirection if the current route
+	// can't be matched, but the cleaned path (superfluous elements like ../
+	// or // removed) or a case-insensitive lookup of it finds a route. The
+	// client is redirected to the fixed path with the same status codes
+	// as RedirectTrailingSlash.
+	//
+	// Sub-routers created with Route and Host inherit both settings.
+	RedirectFixedPath bool
+
+	// HandleOPTIONS enables automatic replies to OPTIONS requests for
+	// matched routes without an OPTIONS handler of their own. The reply
+	// is a 204 with the Allow header listing the route's methods.
+	// Sub-routers created with Route and Host inherit the setting.
+	HandleOPTIONS bool
+
+	// HandleHEAD enables serving HEAD requests with the GET handler of
+	// routes without a HEAD handler of their own, suppressing the response
+	// body. Routes() reports those GET handlers under HEAD as well.
+	// Sub-routers created with Route and Host inherit the setting.
+	HandleHEAD bool
+
+	// Strict enables reporting conflicting and shadowed routes when they are
+	// registered: a route whose pattern conflicts with a route registered
+	// before it, like "/users/{name}" after "/users/{id}", panics with a
+	// *ConflictError listing both patterns. See Validate to audit the routes
+	// of a Mux without panicking. Sub-routers created with Route and Host
+	// inherit the setting.
+	Strict bool
 }
 
 // NewMux returns a newly initialized Mux object that implements the Router
 // interface.
 func NewMux() *Mux {
 	mux := &Mux{tree: &node{}}
+	mux.live.Store(mux.tree)
 	mux.pool.New = func() interface{} {
 		return NewRouteContext()
 	}
@@ -59,6 +117,7 @@ func NewMux() *Mux {
 // interface.
 func New() *Mux {
 	mux := &Mux{tree: &node{}}
+	mux.live.Store(mux.tree)
 	mux.pool.New = func() interface{} {
 		return NewRouteContext()
 	}
@@ -108,72 +167,86 @@ func (mx *Mux) Use(middlewares ...Middleware) {
 
 // Handle adds the route `pattern` that matches any http method to
 // execute the `handler` phi.HandlerFunc.
-func (mx *Mux) Handle(pattern string, handler RequestHandlerFunc) {
-	mx.handle(mALL, pattern, handler)
+func (mx *Mux) Handle(pattern string, handler RequestHandlerFunc, opts ...RouteOption) {
+	mx.handle(mALL, pattern, handler, opts...)
 }
 
 // Method adds the route `pattern` that matches `method` http method to
 // execute the `handler` phi.HandlerFunc.
-func (mx *Mux) Method(method, pattern string, handler RequestHandlerFunc) {
+func (mx *Mux) Method(method, pattern string, handler RequestHandlerFunc, opts ...RouteOption) {
 	m, ok := methodMap[strings.ToUpper(method)]
 	if !ok {
 		panic(fmt.Sprintf("phi: '%s' http method is not supported.", method))
 	}
-	mx.handle(m, pattern, handler)
+	mx.handle(m, pattern, handler, opts...)
+}
+
+// HandleErr adds the route `pattern` that matches any http method to
+// execute the `handler` phi.ErrorHandlerFunc, whose errors are responded
+// to by the error handler of the Mux.
+func (mx *Mux) HandleErr(pattern string, handler ErrorHandlerFunc, opts ...RouteOption) {
+	mx.handle(mALL, pattern, mx.errorHandlerFunc(handler), opts...)
+}
+
+// MethodErr adds the route `pattern` that matches `method` http method to
+// execute the `handler` phi.ErrorHandlerFunc, whose errors are responded
+// to by the error handler of the Mux.
+func (mx *Mux) MethodErr(method, pattern string, handler ErrorHandlerFunc, opts ...RouteOption) {
+	mx.Method(method, pattern, mx.errorHandlerFunc(handler), opts...)
 }
 
 // Connect adds the route `pattern` that matches a CONNECT http method to
 // execute the `handlerFn` phi.RequestHandlerFunc.
-func (mx *Mux) Connect(pattern string, handlerFn RequestHandlerFunc) {
-	mx.handle(mCONNECT, pattern, handlerFn)
+func (mx *Mux) Connect(pattern string, handlerFn RequestHandlerFunc, opts ...RouteOption) {
+	mx.handle(mCONNECT, pattern, handlerFn, opts...)
 }
 
 // Delete adds the route `pattern` that matches a DELETE http method to
 // execute the `handlerFn` phi.RequestHandlerFunc.
-func (mx *Mux) Delete(pattern string, handlerFn RequestHandlerFunc) {
-	mx.handle(mDELETE, pattern, handlerFn)
+func (mx *Mux) Delete(pattern string, handlerFn RequestHandlerFunc, opts ...RouteOption) {
+	mx.handle(mDELETE, pattern, handlerFn, opts...)
 }
 
 // Get adds the route `pattern` that matches a GET http method to
 // execute the `handlerFn` phi.RequestHandlerFunc.
-func (mx *Mux) Get(pattern string, handlerFn RequestHandlerFunc) {
-	mx.handle(mGET, pattern, handlerFn)
+func (mx *Mux) Get(pattern string, handlerFn RequestHandlerFunc, opts ...RouteOption) {
+	mx.handle(mGET, pattern, handlerFn, opts...)
 }
 
 // Head adds the route `pattern` that matches a HEAD http method to
 // execute the `handlerFn` phi.RequestHandlerFunc.
-func (mx *Mux) Head(pattern string, handlerFn RequestHandlerFunc) {
-	mx.handle(mHEAD, pattern, handlerFn)
+func (mx *Mux) Head(pattern string, handlerFn RequestHandlerFunc, opts ...RouteOption) {
+	mx.handle(mHEAD, pattern, handlerFn, opts...)
 }
 
 // Options adds the route `pattern` that matches a OPTIONS http method to
 // execute the `handlerFn` phi.RequestHandlerFunc.
-func (mx *Mux) Options(pattern string, handlerFn RequestHandlerFunc) {
-	mx.handle(mOPTIONS, pattern, handlerFn)
+func (mx *Mux) Options(pattern string, handlerFn RequestHandlerFunc, opts ...RouteOption) {
+	mx.handle(mOPTIONS, pattern, handlerFn, opts...)
 }
 
 // Patch adds the route `pattern` that matches a PATCH http method to
 // execute the `handlerFn` phi.RequestHandlerFunc.
-func (mx *Mux) Patch(pattern string, handlerFn RequestHandlerFunc) {
-	mx.handle(mPATCH, pattern, handlerFn)
+func (mx *Mux) Patch(pattern string, handlerFn RequestHandlerFunc, opts ...RouteOption) {
+	mx.handle(mPATCH, pattern, handlerFn, opts...)
 }
 
 // Post adds the route `pattern` that matches a POST http method to
 // execute the `handlerFn` phi.RequestHandlerFunc.
-func (mx *Mux) Post(pattern string, handlerFn RequestHandlerFunc) {
-	mx.handle(mPOST, pattern, handlerFn)
+func (mx *Mux) Post(pattern string, handlerFn RequestHandlerFunc, opts ...RouteOption) {
+	mx.handle(mPOST, pattern, handlerFn, opts...)
 }
 
 // Put adds the route `pattern` that matches a PUT http method to
 // execute the `handlerFn` phi.RequestHandlerFunc.
-func (mx *Mux) Put(pattern string, handlerFn RequestHandlerFunc) {
-	mx.handle(mPUT, pattern, handlerFn)
+func (mx *Mux) Put(pattern string, handlerFn RequestHandlerFunc, opts ...RouteOption) {
+	mx.handle(mPUT, pattern, handlerFn, opts...)
 }
 
 // Trace adds the route `pattern` that matches a TRACE http method to
 // execute the `handlerFn` phi.RequestHandlerFunc.
-func (mx *Mux) Trace(pattern string, handlerFn RequestHandlerFunc) {
-	mx.handle(mTRACE, pattern, handlerFn)
+func (mx *Mux) Trace(pattern string, handlerFn RequestHandlerFunc, opts ...RouteOption) {
+	mx.handle(mTRACE, pattern, handlerFn, opts...)
 }
 
 // NotFound sets a custom phi.RequestHandlerFunc for routing paths that could
@@ -198,6 +271,7 @@ func (mx *Mux) NotFound(handlerFn RequestHandlerFunc) {
 
 // MethodNotAllowed sets a custom phi.RequestHandlerFunc for routing paths where the
 // method is unresolved. The default handler returns a 405 with an empty body.
+// The Allow header listing the methods of the route is set in any case.
 func (mx *Mux) MethodNotAllowed(handlerFn RequestHandlerFunc) {
 	// Build MethodNotAllowed handler chain
 	m := mx
@@ -216,6 +290,47 @@ func (mx *Mux) MethodNotAllowed(handlerFn RequestHandlerFunc) {
 	})
 }
 
+// ErrorHandler sets a custom handler responding to the errors returned by
+// the phi.ErrorHandlerFunc routes. The default handler responds with the
+// status code and message of an error with a StatusCode method, like
+// *HTTPError, or with a 500 for any other error.
+func (mx *Mux) ErrorHandler(handlerFn func(ctx *fasthttp.RequestCtx, err error)) {
+	m := mx
+	if mx.inline && mx.parent != nil {
+		m = mx.parent
+	}
+
+	// Update the errorHandler from this point forward
+	m.errorHandler = handlerFn
+	m.updateSubRoutes(func(subMux *Mux) {
+		if subMux.errorHandler == nil {
+			subMux.ErrorHandler(handlerFn)
+		}
+	})
+}
+
+// ServeError responds to `err` with the error handler of the Mux.
+func (mx *Mux) ServeError(ctx *fasthttp.RequestCtx, err error) {
+	for mx.inline && mx.parent != nil {
+		mx = mx.parent
+	}
+	if mx.errorHandler != nil {
+		mx.errorHandler(ctx, err)
+		return
+	}
+	handleError(ctx, err)
+}
+
+// errorHandlerFunc adapts an ErrorHandlerFunc to respond to its errors with
+// the error handler of the mux at the time of the request.
+func (mx *Mux) errorHandlerFunc(handler ErrorHandlerFunc) RequestHandlerFunc {
+	return func(ctx *fasthttp.RequestCtx) {
+		if err := handler(ctx); err != nil {
+			mx.ServeError(ctx, err)
+		}
+	}
+}
+
 // With adds inline middlewares for an endpoint handler.
 func (mx *Mux) With(middlewares ...Middleware) Router {
 	// Similarly as in handle(), we must build the mux handler once further
@@ -232,7 +347,8 @@ func (mx *Mux) With(middlewares ...Middleware) Router {
 	}
 	mws = append(mws, middlewares...)
 
-	im := &Mux{inline: true, parent: mx, tree: mx.tree, middlewares: mws}
+	im := &Mux{inline: true, parent: mx, middlewares: mws}
+	mx.inheritSettings(im)
 	return im
 }
 
@@ -249,6 +365,7 @@ func (mx *Mux) Group(fn func(r Router)) {
 // call to Mount. See _examples/.
 func (mx *Mux) Route(pattern string, fn func(r Router)) {
 	subRouter := NewRouter()
+	mx.inheritSettings(subRouter)
 	fn(subRouter)
 	mx.Mount(pattern, subRouter)
 }
@@ -263,11 +380,11 @@ func (mx *Mux) Route(pattern string, fn func(r Router)) {
 func (mx *Mux) Mount(pattern string, handler HandlerFunc) { // nolint: gocyclo
 	// Provide runtime safety for ensuring a pattern isn't mounted on an existing
 	// routing pattern.
-	if mx.tree.findPattern(pattern+"*") || mx.tree.findPattern(pattern+"/*") {
+	if mx.routeTree().findPattern(pattern+"*") || mx.routeTree().findPattern(pattern+"/*") {
 		panic(fmt.Sprintf("phi: attempting to Mount() a handler on an existing path, '%s'", pattern))
 	}
 
-	// Assign sub-Router's with the parent not found & method not allowed handler if not specified.
+	// Assign sub-Router's with the parent not found, method not allowed & error handler if not specified.
 	subr, ok := handler.(*Mux)
 	if ok && subr.notFoundHandler == nil && mx.notFoundHandler != nil {
 		subr.NotFound(mx.notFoundHandler)
@@ -275,21 +392,16 @@ func (mx *Mux) Mount(pattern string, handler HandlerFunc) { // nolint: gocyclo
 	if ok && subr.methodNotAllowedHandler == nil && mx.methodNotAllowedHandler != nil {
 		subr.MethodNotAllowed(mx.methodNotAllowedHandler)
 	}
+	if ok && subr.errorHandler == nil && mx.errorHandler != nil {
+		subr.ErrorHandler(mx.errorHandler)
+	}
 
 	// Wrap the sub-router in a handlerFunc to scope the request path for routing.
-	mountHandler := RequestHandlerFunc(func(ctx *fasthttp.RequestCtx) {
-		rctx := RouteContext(ctx)
-		rctx.RoutePath = mx.nextRoutePath(rctx)
-		handler.Handler(ctx)
-	})
+	mh := &mountHandler{mx: mx, handler: handler}
 
 	if pattern == "" || pattern[len(pattern)-1] != '/' {
-		notFoundHandler := RequestHandlerFunc(func(ctx *fasthttp.RequestCtx) {
-			mx.NotFoundHandler().Handler(ctx)
-		})
-
-		mx.handle(mALL|mSTUB, pattern, mountHandler)
-		mx.handle(mALL|mSTUB, pattern+"/", notFoundHandler)
+		mx.handle(mALL|mSTUB, pattern, mh)
+		mx.handle(mALL|mSTUB, pattern+"/", mountNotFound{mx})
 		pattern += "/"
 	}
 
@@ -298,17 +410,139 @@ func (mx *Mux) Mount(pattern string, handler HandlerFunc) { // nolint: gocyclo
 	if subroutes != nil {
 		method |= mSTUB
 	}
-	n := mx.handle(method, pattern+"*", mountHandler)
+	n := mx.handle(method, pattern+"*", mh)
 
 	if subroutes != nil {
 		n.subroutes = subroutes
 	}
 }
 
+// Update applies the route changes made by `fn` to a copy of the routing
+// tree, and swaps the copy in atomically once `fn` returns, so the requests
+// being served keep on using the previous routes and never see a partial
+// update. Unlike registering routes on the Mux directly, it's safe to call
+// while serving requests. Updates are serialized, and none of the changes
+// are applied if `fn` panics, e.g. on a conflicting route in Strict mode.
+//
+// The Router passed to `fn` removes routes from the copy with Remove, so
+// routes can be replaced in a single update:
+//
+//	r.Update(func(r phi.Router) {
+//	  r.Remove("GET", "/search")
+//	  r.Get("/search", searchV2)
+//	})
+//
+// Host routers added by an update are served along with its routes. The
+// middleware stack of the Mux can't be changed by an update, and neither can
+// its NotFound, MethodNotAllowed and error handlers, which panic if set.
+func (mx *Mux) Update(fn func(r Router)) {
+	m := mx
+	for m.inline && m.parent != nil {
+		m = m.parent
+	}
+
+	m.updateMu.Lock()
+	defer m.updateMu.Unlock()
+
+	live, liveHosts := m.root(), m.hosts
+	m.tree = live.clone()
+	defer func() {
+		if m.tree != m.root() {
+			// fn panicked, drop the changes
+			m.tree, m.hosts = live, liveHosts
+		}
+	}()
+
+	fn(updateRouter{mx})
+	m.liveHosts.Store(m.hosts)
+	m.live.Store(m.tree)
+}
+
+// Remove removes the route registered for `method` and `pattern`, which
+// are the same as passed to Method, or "*" for all the methods of the route
+// like Handle. Mounted sub-routers are removed with their "/*" pattern.
+// The route is removed in an Update, and Remove reports whether there
+// was one to remove.
+func (mx *Mux) Remove(method, pattern string) bool {
+	var removed bool
+	mx.Update(func(r Router) {
+		removed = r.Remove(method, pattern)
+	})
+	return removed
+}
+
+// remove removes a route from the tree routes are registered on.
+func (mx *Mux) remove(method, pattern string) bool {
+	m := mALL
+	if method != "*" {
+		var ok bool
+		m, ok = methodMap[strings.ToUpper(method)]
+		if !ok {
+			panic(fmt.Sprintf("phi: '%s' http method is not supported.", method))
+		}
+	}
+	tree := mx.routeTree()
+	if !tree.removeRoute(m, pattern) {
+		return false
+	}
+	tree.conflicts = nil
+
+	// Mount also registers stub routes on the bare prefix and its trailing slash
+	if m == mALL && len(pattern) > 2 && strings.HasSuffix(pattern, "/*") {
+		tree.removeRoute(mALL|mSTUB, pattern[:len(pattern)-1])
+		tree.removeRoute(mALL|mSTUB, pattern[:len(pattern)-2])
+	}
+	return true
+}
+
+// updateRouter is the Router passed to the func of Mux.Update, whose
+// changes go to the copy of the routing tree being updated.
+type updateRouter struct {
+	*Mux
+}
+
+func (u updateRouter) With(middlewares ...Middleware) Router {
+	return updateRouter{u.Mux.With(middlewares...).(*Mux)}
+}
+
+func (u updateRouter) Group(fn func(r Router)) {
+	fn(u.With())
+}
+
+func (u updateRouter) Remove(method, pattern string) bool {
+	return u.remove(method, pattern)
+}
+
+// The handlers of the Mux are read by the requests being served, so setting
+// them in an update would race with serving.
+
+func (u updateRouter) NotFound(handlerFn RequestHandlerFunc) {
+	panic("phi: NotFound can't be set in an Update")
+}
+
+func (u updateRouter) MethodNotAllowed(handlerFn RequestHandlerFunc) {
+	panic("phi: MethodNotAllowed can't be set in an Update")
+}
+
+func (u updateRouter) ErrorHandler(handlerFn func(ctx *fasthttp.RequestCtx, err error)) {
+	panic("phi: ErrorHandler can't be set in an Update")
+}
+
 // Routes returns a slice of routing information from the tree,
 // useful for traversing available routes of a router.
 func (mx *Mux) Routes() []Route {
-	return mx.tree.routes()
+	rts := mx.root().routes()
+	if mx.HandleHEAD {
+		for _, rt := range rts {
+			if _, ok := rt.Handlers["HEAD"]; ok {
+				continue
+			}
+			if h, ok := rt.Handlers["GET"]; ok {
+				rt.Handlers["HEAD"] = h
+			}
+		}
+	}
+	return rts
 }
 
 // Middlewares returns a slice of middleware handler functions.
@@ -318,24 +552,55 @@ func (mx *Mux) Middlewares() Middlewares {
 
 // Match searches the routing tree for a handler that matches the method/path.
 // It's similar to routing a http request, but without executing the handler
-// thereafter.
+// thereafter. With HandleHEAD, HEAD matches the GET routes.
 //
 // Note: the *Context state is updated during execution, so manage
 // the state carefully or make a NewRouteContext().
 func (mx *Mux) Match(rctx *Context, method, path string) bool {
+	_, ok := mx.match(rctx, method, path)
+	return ok
+}
+
+// match is Match returning the Mux serving the matched route as well, which
+// is a mounted sub-router of `mx` for the paths routed to one.
+func (mx *Mux) match(rctx *Context, method, path string) (*Mux, bool) {
 	m, ok := methodMap[method]
 	if !ok {
-		return false
+		return nil, false
 	}
 
-	node, _, h := mx.tree.FindRoute(rctx, m, path)
+	node, _, h := mx.root().FindRoute(rctx, m, path)
+	if h == nil && m == mHEAD && mx.HandleHEAD {
+		node, _, h = mx.root().FindRoute(rctx, mGET, path)
+	}
 
 	if node != nil && node.subroutes != nil {
 		rctx.RoutePath = mx.nextRoutePath(rctx)
-		return node.subroutes.Match(rctx, method, rctx.RoutePath)
+		return matchRoutes(node.subroutes, rctx, method, rctx.RoutePath)
 	}
 
-	return h != nil
+	// The bare prefix of a mount is routed to the root of the sub-router,
+	// while the prefix with a trailing slash isn't routed.
+	switch h := h.(type) {
+	case *mountHandler:
+		if subroutes, ok := h.handler.(Routes); ok {
+			rctx.RoutePath = mx.nextRoutePath(rctx)
+			return matchRoutes(subroutes, rctx, method, rctx.RoutePath)
+		}
+	case mountNotFound:
+		return nil, false
+	}
+
+	return mx, h != nil
+}
+
+// matchRoutes matches the mounted `routes`, reporting the Mux serving the
+// matched route when they're one.
+func matchRoutes(routes Routes, rctx *Context, method, path string) (*Mux, bool) {
+	if subMux, ok := routes.(*Mux); ok {
+		return subMux.match(rctx, method, path)
+	}
+	return nil, routes.Match(rctx, method, path)
 }
 
 // NotFoundHandler returns the default Mux 404 responder whenever a route
@@ -356,12 +621,17 @@ func (mx *Mux) MethodNotAllowedHandler() RequestHandlerFunc {
 	return methodNotAllowedHandler
 }
 
-// ServeFiles  provide fasthttp static file service
+// ServeFiles  provide fasthttp static file service on `path`, which must end
+// with a wildcard segment, e.g. "/static/*filepath".
 func (mx *Mux) ServeFiles(path string, rootPath string) {
-	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
-		panic("path must end with /*filepath in path '" + path + "'")
+	idx := strings.LastIndexByte(path, '/')
+	if idx < 0 {
+		panic("path must end with a wildcard segment such as /*filepath in path '" + path + "'")
+	}
+	if segTyp, _, _, _, ps, _ := patNextSegment(path[idx+1:]); segTyp != ntCatchAll || ps != 0 {
+		panic("path must end with a wildcard segment such as /*filepath in path '" + path + "'")
 	}
-	prefix := path[:len(path)-10]
+	prefix := path[:idx]
 
 	stripSlashes := strings.Count(prefix, "/")
 
@@ -395,7 +665,7 @@ func (mx *Mux) buildRouteHandler() {
 
 // handle registers a phi.HandlerFunc in the routing tree for a particular http method
 // and routing pattern.
-func (mx *Mux) handle(method methodTyp, pattern string, handler HandlerFunc) *node {
+func (mx *Mux) handle(method methodTyp, pattern string, handler HandlerFunc, opts ...RouteOption) *node {
 	if len(pattern) == 0 || pattern[0] != '/' {
 		panic(fmt.Sprintf("phi: routing pattern must begin with '/' in '%s'", pattern))
 	}
@@ -414,8 +684,22 @@ func (mx *Mux) handle(method methodTyp, pattern string, handler HandlerFunc) *no
 		h = handler
 	}
 
+	tree := mx.routeTree()
+	if mx.Strict {
+		if err := tree.findConflict(method, pattern); err != nil {
+			panic(err)
+		}
+	}
+
+	// Routes registered by an update replace the earlier ones on purpose
+	if tree != mx.root() {
+		opts = append(opts[:len(opts):len(opts)], updatedRoute)
+	}
+
 	// Add the endpoint to the tree and return the node
-	return mx.tree.InsertRoute(method, pattern, h)
+	n := tree.InsertRoute(method, pattern, h, opts...)
+	tree.addPattern(method, pattern)
+	return n
 }
 
 // routeHTTP routes a phi.Request through the Mux routing tree to serve
@@ -430,28 +714,219 @@ func (mx *Mux) routeHTTP(ctx *fasthttp.RequestCtx) {
 		routePath = string(ctx.Path())
 	}
 
+	// Continue routing at the host router matching the request, if any
+	if hosts := mx.hostRoutes(); len(hosts) > 0 {
+		if hm := routeHost(ctx, rctx, hosts); hm != nil {
+			hm.Handler(ctx)
+			return
+		}
+	}
+
 	// Check if method is supported by phi
 	if rctx.RouteMethod == "" {
 		rctx.RouteMethod = string(ctx.Method())
 	}
 	method, ok := methodMap[rctx.RouteMethod]
+	tree := mx.root()
 	if !ok {
+		// Continue routing at the sub-router mounted on the path, if any
+		if _, eps, h := tree.FindRoute(rctx, mALL, routePath); h != nil && eps[mSTUB] != nil {
+			h.Handler(ctx)
+			return
+		}
+		// Look up the path with no method to collect the allowed ones
+		tree.FindRoute(rctx, 0, routePath)
+		mx.setAllowHeader(ctx, rctx)
 		mx.MethodNotAllowedHandler().Handler(ctx)
 		return
 	}
 
 	// Find the route
-	if _, _, h := mx.tree.FindRoute(rctx, method, routePath); h != nil {
+	if _, _, h := tree.FindRoute(rctx, method, routePath); h != nil {
 		h.Handler(ctx)
 		return
 	}
+	if method == mHEAD && mx.HandleHEAD && rctx.allowedMethodTyps&mGET != 0 {
+		if _, _, h := tree.FindRoute(rctx, mGET, routePath); h != nil {
+			ctx.Response.SkipBody = true
+			h.Handler(ctx)
+			return
+		}
+	}
 	if rctx.methodNotAllowed {
+		mx.setAllowHeader(ctx, rctx)
+		if method == mOPTIONS && mx.HandleOPTIONS {
+			ctx.SetStatusCode(fasthttp.StatusNoContent)
+			return
+		}
 		mx.MethodNotAllowedHandler().Handler(ctx)
 	} else {
-		mx.NotFoundHandler().Handler(ctx)
+		mx.handleNotFound(ctx)
 	}
 }
 
+// setAllowHeader responds with the methods allowed on the matched route.
+func (mx *Mux) setAllowHeader(ctx *fasthttp.RequestCtx, rctx *Context) {
+	if allowed := mx.allowedMethods(rctx.allowedMethodTyps); len(allowed) > 0 {
+		ctx.Response.Header.Set("Allow", strings.Join(allowed, ", "))
+	}
+}
+
+// AllowedMethods returns the methods allowed on the route matching `path`,
+// as sent by the Mux in the Allow header, including those served by the
+// HandleHEAD and HandleOPTIONS settings. Paths routed to a mounted sub-router
+// are resolved by it, with its settings. It returns nil when no route
+// matches the path.
+func (mx *Mux) AllowedMethods(path string) []string {
+	var methods methodTyp
+	var serving *Mux
+	rctx := NewRouteContext()
+	for m, mt := range methodMap {
+		rctx.Reset()
+		subMux, ok := mx.match(rctx, m, path)
+		if !ok {
+			continue
+		}
+		// The settings of the sub-router apply only if it serves all
+		// the methods
+		if methods != 0 && subMux != serving {
+			subMux = mx
+		}
+		methods |= mt
+		serving = subMux
+	}
+	if serving == nil {
+		serving = mx
+	}
+	return serving.allowedMethods(methods)
+}
+
+// allowedMethods lists the methods of the routes in `methods`, along with
+// those served by the HandleHEAD and HandleOPTIONS settings.
+func (mx *Mux) allowedMethods(methods methodTyp) []string {
+	if methods == 0 {
+		return nil
+	}
+	if mx.HandleHEAD && methods&mGET != 0 {
+		methods |= mHEAD
+	}
+	allowed := make([]string, 0, len(methodMap))
+	for m, mt := range methodMap {
+		if methods&mt == mt {
+			allowed = append(allowed, m)
+		}
+	}
+	sort.Strings(allowed)
+	if mx.HandleOPTIONS && methods&mOPTIONS == 0 {
+		allowed = append(allowed, "OPTIONS")
+	}
+	return allowed
+}
+
+// handleNotFound responds to a request that could not be routed, redirecting
+// it to a matching path instead when enabled on the mux.
+func (mx *Mux) handleNotFound(ctx *fasthttp.RequestCtx) {
+	if (mx.RedirectTrailingSlash || mx.RedirectFixedPath) && mx.redirect(ctx) {
+		return
+	}
+	mx.NotFoundHandler().Handler(ctx)
+}
+
+// redirect looks for a route matching the fixed request path, and redirects
+// the request to it if found. Candidates are matched on the routing path of
+// this mux and prefixed with what parent routers already consumed.
+func (mx *Mux) redirect(ctx *fasthttp.RequestCtx) bool {
+	rctx := RouteContext(ctx)
+	fullPath := string(ctx.Path())
+	routePath := rctx.RoutePath
+	if routePath == "" {
+		routePath = fullPath
+	}
+	if !strings.HasSuffix(fullPath, routePath) {
+		return false
+	}
+	prefix := fullPath[:len(fullPath)-len(routePath)]
+
+	method := string(ctx.Method())
+	if rctx.RouteMethod != "" {
+		method = rctx.RouteMethod
+	}
+	m, ok := methodMap[method]
+	if !ok {
+		return false
+	}
+
+	var fixedPath string
+	if mx.RedirectTrailingSlash && routePath != "/" {
+		if routePath[len(routePath)-1] == '/' {
+			fixedPath = routePath[:len(routePath)-1]
+		} else {
+			fixedPath = routePath + "/"
+		}
+		if !mx.Match(NewRouteContext(), method, fixedPath) {
+			fixedPath = ""
+		}
+	}
+
+	if fixedPath == "" && mx.RedirectFixedPath {
+		cleanPath := CleanPath(routePath)
+		if fp, ok := mx.root().findFixedPath(m, cleanPath, nil); ok {
+			fixedPath = string(fp)
+		} else if mx.RedirectTrailingSlash && cleanPath != "/" {
+			if cleanPath[len(cleanPath)-1] == '/' {
+				cleanPath = cleanPath[:len(cleanPath)-1]
+			} else {
+				cleanPath += "/"
+			}
+			if fp, ok := mx.root().findFixedPath(m, cleanPath, nil); ok {
+				fixedPath = string(fp)
+			}
+		}
+	}
+
+	if fixedPath == "" || fixedPath == routePath {
+		return false
+	}
+
+	code := fasthttp.StatusPermanentRedirect
+	if m == mGET || m == mHEAD {
+		code = fasthttp.StatusMovedPermanently
+	}
+
+	location := (&url.URL{Path: prefix + fixedPath}).EscapedPath()
+	if qs := ctx.URI().QueryString(); len(qs) > 0 {
+		location += "?" + string(qs)
+	}
+	ctx.Redirect(location, code)
+	return true
+}
+
+// mountHandler is the handler of the routes of a mount, which scopes the
+// request path for routing by the mounted handler.
+type mountHandler struct {
+	mx      *Mux
+	handler HandlerFunc
+}
+
+func (h *mountHandler) Handler(ctx *fasthttp.RequestCtx) {
+	rctx := RouteContext(ctx)
+	rctx.RoutePath = h.mx.nextRoutePath(rctx)
+	h.handler.Handler(ctx)
+}
+
+// mountNotFound is the handler of the mount prefix with a trailing slash,
+// when the mount pattern has none.
+type mountNotFound struct {
+	mx *Mux
+}
+
+func (h mountNotFound) Handler(ctx *fasthttp.RequestCtx) {
+	h.mx.handleNotFound(ctx)
+}
+
+// nextRoutePath returns the routing path of a mounted handler. Mounts are
+// registered on a bare `*` wildcard, so the named wildcards of routes don't
+// affect it.
 func (mx *Mux) nextRoutePath(rctx *Context) string {
 	routePath := "/"
 	nx := len(rctx.routeParams.Keys) - 1 // index of last param in list
@@ -461,15 +936,53 @@ func (mx *Mux) nextRoutePath(rctx *Context) string {
 	return routePath
 }
 
+// routeTree returns the tree routes are registered on, which is shared
+// by inline muxes.
+func (mx *Mux) routeTree() *node {
+	for mx.inline && mx.parent != nil {
+		mx = mx.parent
+	}
+	return mx.tree
+}
+
+// hostRoutes returns the host routers served to requests.
+func (mx *Mux) hostRoutes() []*hostRoute {
+	for mx.inline && mx.parent != nil {
+		mx = mx.parent
+	}
+	hosts, _ := mx.liveHosts.Load().([]*hostRoute)
+	return hosts
+}
+
+// root returns the tree served to requests.
+func (mx *Mux) root() *node {
+	for mx.inline && mx.parent != nil {
+		mx = mx.parent
+	}
+	return mx.live.Load().(*node)
+}
+
+// inheritSettings copies the mux settings onto a newly created sub-router.
+func (mx *Mux) inheritSettings(subMux *Mux) {
+	subMux.RedirectTrailingSlash = mx.RedirectTrailingSlash
+	subMux.RedirectFixedPath = mx.RedirectFixedPath
+	subMux.HandleOPTIONS = mx.HandleOPTIONS
+	subMux.HandleHEAD = mx.HandleHEAD
+	subMux.Strict = mx.Strict
+}
+
 // Recursively update data on child routers.
 func (mx *Mux) updateSubRoutes(fn func(subMux *Mux)) {
-	for _, r := range mx.tree.routes() {
+	for _, r := range mx.routeTree().routes() {
 		subMux, ok := r.SubRoutes.(*Mux)
 		if !ok {
 			continue
 		}
 		fn(subMux)
 	}
+	for _, hr := range mx.hostRoutes() {
+		fn(hr.mux)
+	}
 }
 
 func notFound(ctx *fasthttp.RequestCtx) {
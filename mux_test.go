@@ -2,8 +2,11 @@ package phi
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -71,6 +74,39 @@ func TestMuxURLParams(t *testing.T) {
 	e.GET("/sub/hello").Expect().Status(200).Text().Equal("subhello")
 }
 
+func TestMuxURLParamTypes(t *testing.T) {
+	r := NewRouter()
+	r.Get("/items/{id:int}", func(ctx *fasthttp.RequestCtx) {
+		id, err := URLParamInt(ctx, "id")
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		fmt.Fprintf(ctx, "item %d", id)
+	})
+	r.Get("/reports/{day:date}", func(ctx *fasthttp.RequestCtx) {
+		day, err := URLParamDate(ctx, "day")
+		if err != nil {
+			ctx.Error(err.Error(), 400)
+			return
+		}
+		ctx.WriteString(day.Weekday().String())
+	})
+	r.Get("/missing", func(ctx *fasthttp.RequestCtx) {
+		if _, err := URLParamUint64(ctx, "id"); err != nil {
+			ctx.Error(err.Error(), 400)
+		}
+	})
+
+	e := newFastHTTPTester(t, r)
+	e.GET("/items/42").Expect().Status(200).Text().Equal("item 42")
+	e.GET("/items/4x2").Expect().Status(404)
+	e.GET("/items/99999999999999999999").Expect().Status(400)
+	e.GET("/reports/2019-03-11").Expect().Status(200).Text().Equal("Monday")
+	e.GET("/reports/2019-02-31").Expect().Status(404)
+	e.GET("/missing").Expect().Status(400).Text().Equal("phi: url param 'id' is missing")
+}
+
 func TestMuxUse(t *testing.T) {
 	r := NewRouter()
 	r.Use(func(next RequestHandlerFunc) RequestHandlerFunc {
@@ -249,9 +285,15 @@ func TestMuxMethodNotAllowed(t *testing.T) {
 			ctx.WriteString("ok")
 		})
 
+		r.Put("/", func(ctx *fasthttp.RequestCtx) {
+			ctx.WriteString("ok")
+		})
+
 		e := newFastHTTPTester(t, r)
 		e.GET("/").Expect().Status(200).Text().Equal("ok")
 		e.POST("/").Expect().Status(405).Text().Equal("bad method")
+		e.POST("/").Expect().Header("Allow").Equal("GET, PUT")
+		e.Request("PURGE", "/").Expect().Status(405).Header("Allow").Equal("GET, PUT")
 	})
 
 	t.Run("nested", func(t *testing.T) {
@@ -312,6 +354,818 @@ func TestMuxBigMux(t *testing.T) {
 	e.GET("/user/nothing").Expect().Status(404).Text().Equal("no such user+user+reqid=1")
 }
 
+func TestMuxURL(t *testing.T) {
+	h := func(ctx *fasthttp.RequestCtx) {}
+
+	r := NewRouter()
+	r.Get("/", h, Name("index"))
+	r.Get("/users/{id:[0-9]+}", h, Name("user"))
+	r.Method("POST", "/users/{id}/posts/{slug}", h, Name("post"))
+	r.Handle("/files/*", h, Name("files"))
+	r.Get("/assets/*path", h, Name("assets"))
+	r.Get("/repos/{repo:*2}", h, Name("repos"))
+	r.Get("/reports/{year?:int}/{month?}", h, Name("reports"))
+	r.Route("/orgs/{org}", func(r Router) {
+		r.Get("/", h, Name("org"))
+		r.Get("/repos/{repo:[a-z]+}", h, Name("repo"))
+	})
+
+	tests := []struct {
+		name   string
+		params []string
+		url    string
+		err    bool
+	}{
+		{name: "index", url: "/"},
+		{name: "user", params: []string{"id", "42"}, url: "/users/42"},
+		{name: "user", params: []string{"id", "abc"}, err: true},
+		{name: "user", err: true},
+		{name: "user", params: []string{"id"}, err: true},
+		{name: "post", params: []string{"id", "1", "slug", "hello world"}, url: "/users/1/posts/hello%20world"},
+		{name: "post", params: []string{"id", "1", "slug", "a/b"}, err: true},
+		{name: "files", params: []string{"*", "css/site.css"}, url: "/files/css/site.css"},
+		{name: "assets", params: []string{"path", "img/logo.png"}, url: "/assets/img/logo.png"},
+		{name: "repos", params: []string{"repo", "acme/phi"}, url: "/repos/acme/phi"},
+		{name: "repos", params: []string{"repo", "acme"}, err: true},
+		{name: "reports", url: "/reports"},
+		{name: "reports", params: []string{"year", "2019"}, url: "/reports/2019"},
+		{name: "reports", params: []string{"year", "2019", "month", "03"}, url: "/reports/2019/03"},
+		{name: "reports", params: []string{"year", "last"}, err: true},
+		{name: "reports", params: []string{"month", "02"}, err: true},
+		{name: "user", params: []string{"id", "42", "page", "2"}, err: true},
+		{name: "org", params: []string{"org", "acme"}, url: "/orgs/acme"},
+		{name: "repo", params: []string{"org", "acme", "repo", "phi"}, url: "/orgs/acme/repos/phi"},
+		{name: "repo", params: []string{"org", "acme", "repo", "42"}, err: true},
+		{name: "nothing", err: true},
+	}
+
+	for i, tt := range tests {
+		url, err := r.URL(tt.name, tt.params...)
+		if tt.err {
+			if err == nil {
+				t.Errorf("input [%d]: url for '%s' expecting error, got:%s", i, tt.name, url)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("input [%d]: url for '%s' unexpected error: %v", i, tt.name, err)
+		}
+		if url != tt.url {
+			t.Errorf("input [%d]: url for '%s' expecting:%s , got:%s", i, tt.name, tt.url, url)
+		}
+	}
+}
+
+func TestMuxStrict(t *testing.T) {
+	h := func(ctx *fasthttp.RequestCtx) {}
+
+	tests := []struct {
+		existing []string // routes registered before, as "METHOD pattern"
+		route    string   // route registered last
+		conflict bool
+	}{
+		{existing: []string{"GET /users/{id}"}, route: "GET /users/{name}", conflict: true},
+		{existing: []string{"GET /users/{id}"}, route: "POST /users/{name}", conflict: false},
+		{existing: []string{"GET /users/{id}"}, route: "GET /users/{id}", conflict: true},
+		{existing: []string{"GET /users/{id}"}, route: "GET /users/me", conflict: false},
+		{existing: []string{"GET /users/{id}"}, route: "GET /users/{id:int}", conflict: false},
+		{existing: []string{"GET /users/{id:int}"}, route: "GET /users/{id:[0-9]+}", conflict: true},
+		{existing: []string{"GET /users/{id:[0-9]+}"}, route: "GET /users/{id:\\d{1,3}}", conflict: true},
+		{existing: []string{"GET /users/{id:[0-9]+}"}, route: "GET /users/{slug:[a-z]+}", conflict: false},
+		{existing: []string{"GET /users/{id:int}"}, route: "GET /users/{name:alpha}", conflict: false},
+		{existing: []string{"GET /files/*"}, route: "GET /files/{path:*}", conflict: true},
+		{existing: []string{"GET /files/{path:*}"}, route: "GET /files/*", conflict: false},
+		{existing: []string{"GET /reports"}, route: "GET /reports/{year?}", conflict: true},
+		{existing: []string{"GET /a/{x}.{y}"}, route: "GET /a/{x}-{y}", conflict: false},
+		{existing: []string{"PUT /items/{id}"}, route: "* /items/{key}", conflict: true},
+	}
+
+	for i, tt := range tests {
+		r := NewRouter()
+		r.Strict = true
+		for _, rt := range tt.existing {
+			fields := strings.Fields(rt)
+			r.Method(fields[0], fields[1], h)
+		}
+
+		fields := strings.Fields(tt.route)
+		recv := catchPanic(func() {
+			if fields[0] == "*" {
+				r.Handle(fields[1], h)
+			} else {
+				r.Method(fields[0], fields[1], h)
+			}
+		})
+		if tt.conflict {
+			if _, ok := recv.(*ConflictError); !ok {
+				t.Errorf("input [%d]: registering '%s' after %v expecting a conflict, got:%v", i, tt.route, tt.existing, recv)
+			}
+		} else if recv != nil {
+			t.Errorf("input [%d]: registering '%s' after %v unexpected panic: %v", i, tt.route, tt.existing, recv)
+		}
+	}
+
+	// Sub-routers inherit the strict mode
+	r := NewRouter()
+	r.Strict = true
+	recv := catchPanic(func() {
+		r.Route("/orgs", func(r Router) {
+			r.Get("/{org}", h)
+			r.With().Get("/{name}", h)
+		})
+	})
+	err, ok := recv.(*ConflictError)
+	if !ok {
+		t.Fatalf("expecting a conflict in a sub-router, got:%v", recv)
+	}
+	if err.Error() != "phi: GET '/{name}' conflicts with '/{org}', the routes only differ in their param keys" {
+		t.Errorf("unexpected conflict error: %s", err)
+	}
+
+	// The patterns are checked against the routes of updates
+	r = NewRouter()
+	r.Strict = true
+	r.Get("/users/{id}", h)
+	r.Update(func(r Router) {
+		r.Remove("GET", "/users/{id}")
+		r.Get("/users/{name}", h)
+		r.Get("/items/{id}", h)
+	})
+	if recv := catchPanic(func() { r.Get("/users/{id}", h) }); recv == nil {
+		t.Errorf("expecting a conflict with a route of the update")
+	}
+	if recv := catchPanic(func() { r.Get("/items/{key}", h) }); recv == nil {
+		t.Errorf("expecting a conflict with a route of the update")
+	}
+	r.Remove("GET", "/items/{id}")
+	if recv := catchPanic(func() { r.Get("/items/{key}", h) }); recv != nil {
+		t.Errorf("expecting no conflict with a removed route, got:%v", recv)
+	}
+}
+
+func TestMuxValidate(t *testing.T) {
+	h := func(ctx *fasthttp.RequestCtx) {}
+
+	r := NewRouter()
+	r.Get("/users/{id}", h)
+	r.Get("/users/{name}", h)
+	r.Get("/items/{id:[0-9]+}", h)
+	r.Get("/items/{id:int}", h)
+	r.Get("/items/{slug:[a-z]+}", h)
+	r.Route("/orgs/{org}", func(r Router) {
+		r.Get("/", h)
+		r.Post("/repos/{repo}", h)
+		r.Post("/repos/{name}", h)
+	})
+
+	errs := r.Validate()
+	expected := []string{
+		"phi: GET '/items/{id:int}' conflicts with '/items/{id:[0-9]+}', the values of their param types or regexps overlap",
+		"phi: GET '/users/{name}' conflicts with '/users/{id}', the routes only differ in their param keys",
+		"phi: POST '/orgs/{org}/repos/{name}' conflicts with '/orgs/{org}/repos/{repo}', the routes only differ in their param keys",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expecting %d errors, got:%d %v", len(expected), len(errs), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("input [%d]: expecting error:%s , got:%s", i, expected[i], err)
+		}
+	}
+
+	if errs := NewRouter().Validate(); len(errs) != 0 {
+		t.Errorf("expecting no errors, got:%v", errs)
+	}
+
+	// a route replaced several times is reported once, and not at all
+	// once replaced by an update
+	r = NewRouter()
+	for i := 0; i < 3; i++ {
+		r.Get("/ping", h)
+	}
+	if errs := r.Validate(); len(errs) != 1 {
+		t.Errorf("expecting 1 error, got:%d %v", len(errs), errs)
+	}
+	for i := 0; i < 3; i++ {
+		r.Update(func(r Router) {
+			r.Get("/ping", h)
+		})
+	}
+	if errs := r.Validate(); len(errs) != 0 {
+		t.Errorf("expecting no errors, got:%v", errs)
+	}
+}
+
+func TestMuxUpdate(t *testing.T) {
+	text := func(s string) RequestHandlerFunc {
+		return func(ctx *fasthttp.RequestCtx) {
+			ctx.WriteString(s)
+		}
+	}
+
+	r := NewRouter()
+	r.Get("/", text("index"))
+	r.Get("/beta", text("beta"))
+	r.Handle("/any", text("any"))
+	r.Route("/admin", func(r Router) {
+		r.Get("/", text("admin"))
+	})
+
+	e := newFastHTTPTester(t, r)
+	e.GET("/beta").Expect().Status(200).Text().Equal("beta")
+
+	r.Update(func(r Router) {
+		if !r.Remove("GET", "/beta") {
+			t.Errorf("expecting /beta to be removed")
+		}
+		r.Get("/gamma", text("gamma"))
+		r.With().Get("/delta", text("delta"))
+	})
+	e.GET("/beta").Expect().Status(404)
+	e.GET("/gamma").Expect().Status(200).Text().Equal("gamma")
+	e.GET("/delta").Expect().Status(200).Text().Equal("delta")
+	e.GET("/").Expect().Status(200).Text().Equal("index")
+
+	if r.Remove("GET", "/beta") {
+		t.Errorf("expecting nothing to remove")
+	}
+
+	// removing a method of a route for all methods
+	if !r.Remove("POST", "/any") {
+		t.Errorf("expecting POST /any to be removed")
+	}
+	e.GET("/any").Expect().Status(200).Text().Equal("any")
+	e.POST("/any").Expect().Status(405)
+
+	// removing a mounted sub-router along with its stub routes
+	if !r.Remove("*", "/admin/*") {
+		t.Errorf("expecting /admin/* to be removed")
+	}
+	e.GET("/admin").Expect().Status(404)
+	e.GET("/admin/").Expect().Status(404)
+	r.Update(func(r Router) {
+		r.Route("/admin", func(r Router) {
+			r.Get("/", text("admin v2"))
+		})
+	})
+	e.GET("/admin").Expect().Status(200).Text().Equal("admin v2")
+
+	// a panicking update leaves the routes as they were
+	recv := catchPanic(func() {
+		r.Update(func(r Router) {
+			r.Remove("GET", "/gamma")
+			r.Get("/epsilon", text("epsilon"))
+			panic("oops")
+		})
+	})
+	if recv == nil {
+		t.Fatalf("expecting the update to panic")
+	}
+	e.GET("/gamma").Expect().Status(200).Text().Equal("gamma")
+	e.GET("/epsilon").Expect().Status(404)
+	r.Get("/epsilon", text("epsilon"))
+	e.GET("/epsilon").Expect().Status(200).Text().Equal("epsilon")
+}
+
+func TestMuxUpdateConcurrent(t *testing.T) {
+	r := NewRouter()
+	r.Get("/ping", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("pong")
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			pattern := fmt.Sprintf("/flag/%d", i)
+			r.Update(func(r Router) {
+				r.Get(pattern, func(ctx *fasthttp.RequestCtx) {})
+			})
+			r.Remove("GET", pattern)
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		ctx := newRequestCtx("GET", "example.com", "/ping")
+		r.Handler(ctx)
+		if string(ctx.Response.Body()) != "pong" {
+			t.Fatalf("expecting pong, got:%s", ctx.Response.Body())
+		}
+	}
+	<-done
+
+	if rts := r.Routes(); len(rts) != 1 {
+		t.Errorf("expecting 1 route, got:%d", len(rts))
+	}
+}
+
+func TestMuxUpdateHandlers(t *testing.T) {
+	r := NewRouter()
+	r.Get("/ping", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("pong")
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			ctx := newRequestCtx("GET", "example.com", "/nothing")
+			r.Handler(ctx)
+			if ctx.Response.StatusCode() != 404 {
+				t.Errorf("expecting 404, got:%d", ctx.Response.StatusCode())
+				return
+			}
+		}
+	}()
+
+	// the handlers of the Mux can't be set while serving
+	updates := map[string]func(r Router){
+		"NotFound":         func(r Router) { r.NotFound(func(ctx *fasthttp.RequestCtx) {}) },
+		"MethodNotAllowed": func(r Router) { r.MethodNotAllowed(func(ctx *fasthttp.RequestCtx) {}) },
+		"ErrorHandler":     func(r Router) { r.ErrorHandler(func(ctx *fasthttp.RequestCtx, err error) {}) },
+		"With().NotFound":  func(r Router) { r.With().NotFound(func(ctx *fasthttp.RequestCtx) {}) },
+	}
+	for name, update := range updates {
+		recv := catchPanic(func() {
+			r.Update(func(r Router) {
+				r.Get("/nothing", func(ctx *fasthttp.RequestCtx) {})
+				update(r)
+			})
+		})
+		if recv == nil {
+			t.Errorf("%s: expecting the update to panic", name)
+		}
+	}
+	<-done
+
+	if rts := r.Routes(); len(rts) != 1 {
+		t.Errorf("expecting the updates to be dropped, got %d routes", len(rts))
+	}
+}
+
+func TestMuxHostUpdateConcurrent(t *testing.T) {
+	text := func(s string) RequestHandlerFunc {
+		return func(ctx *fasthttp.RequestCtx) {
+			ctx.WriteString(s)
+		}
+	}
+
+	r := NewRouter()
+	r.Get("/", text("default"))
+	r.Host("{sub}.example.com", func(r Router) {
+		r.Get("/", text("sub"))
+	})
+	r.Host("api.example.com", func(r Router) {
+		r.Get("/", text("api"))
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			// static hosts are inserted ahead of the patterns
+			host := fmt.Sprintf("h%d.example.org", i)
+			if i%2 == 1 {
+				host = fmt.Sprintf("{sub}.h%d.example.org", i)
+			}
+			r.Update(func(r Router) {
+				r.Host(host, func(r Router) {
+					r.Get("/", text(host))
+				})
+			})
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		for host, body := range map[string]string{"api.example.com": "api", "www.example.com": "sub"} {
+			ctx := newRequestCtx("GET", host, "/")
+			r.Handler(ctx)
+			if string(ctx.Response.Body()) != body {
+				t.Fatalf("expecting %s, got:%s", body, ctx.Response.Body())
+			}
+		}
+	}
+	<-done
+
+	ctx := newRequestCtx("GET", "h98.example.org", "/")
+	r.Handler(ctx)
+	if string(ctx.Response.Body()) != "h98.example.org" {
+		t.Errorf("expecting the host of the update, got:%s", ctx.Response.Body())
+	}
+
+	// the hosts of a panicking update aren't served
+	catchPanic(func() {
+		r.Update(func(r Router) {
+			r.Host("oops.example.org", func(r Router) {
+				r.Get("/", text("oops"))
+			})
+			panic("oops")
+		})
+	})
+	ctx = newRequestCtx("GET", "oops.example.org", "/")
+	r.Handler(ctx)
+	if string(ctx.Response.Body()) != "default" {
+		t.Errorf("expecting the default routes, got:%s", ctx.Response.Body())
+	}
+}
+
+func TestMuxErrorHandler(t *testing.T) {
+	fail := func(err error) ErrorHandlerFunc {
+		return func(ctx *fasthttp.RequestCtx) error {
+			return err
+		}
+	}
+
+	r := NewRouter()
+	r.MethodErr("GET", "/ok", func(ctx *fasthttp.RequestCtx) error {
+		ctx.WriteString("ok")
+		return nil
+	})
+	r.MethodErr("GET", "/missing", fail(NewHTTPError(404, "no such thing")))
+	r.MethodErr("GET", "/teapot", fail(&HTTPError{Status: 418, Err: errors.New("hidden")}))
+	r.HandleErr("/boom", fail(errors.New("secret details")))
+
+	e := newFastHTTPTester(t, r)
+	e.GET("/ok").Expect().Status(200).Text().Equal("ok")
+	e.GET("/missing").Expect().Status(404).Text().Equal("no such thing")
+	e.GET("/teapot").Expect().Status(418).Text().Equal("I'm a teapot")
+	e.POST("/boom").Expect().Status(500).Text().Equal("Internal Server Error")
+
+	// the headers set upstream are kept in the error responses
+	ctx := newRequestCtx("GET", "example.com", "/missing")
+	ctx.Response.Header.Set("X-Request-Id", "42")
+	r.Handler(ctx)
+	if ctx.Response.StatusCode() != 404 || string(ctx.Response.Header.Peek("X-Request-Id")) != "42" {
+		t.Errorf("expecting a 404 with X-Request-Id, got:\n%s", ctx.Response.Header.String())
+	}
+	if ct := string(ctx.Response.Header.ContentType()); ct != "text/plain; charset=utf-8" {
+		t.Errorf("expecting a text/plain error, got:%s", ct)
+	}
+
+	// sub-routers inherit the error handler, whether mounted before or after it's set
+	r.Route("/before", func(r Router) {
+		r.MethodErr("GET", "/", fail(errors.New("before")))
+	})
+	r.ErrorHandler(func(ctx *fasthttp.RequestCtx, err error) {
+		ctx.SetStatusCode(503)
+		ctx.WriteString("handled: " + err.Error())
+	})
+	r.Route("/after", func(r Router) {
+		r.With().MethodErr("GET", "/", fail(errors.New("after")))
+		r.Route("/own", func(r Router) {
+			r.ErrorHandler(func(ctx *fasthttp.RequestCtx, err error) {
+				ctx.SetStatusCode(400)
+				ctx.WriteString("own: " + err.Error())
+			})
+			r.MethodErr("GET", "/", fail(errors.New("own")))
+		})
+	})
+
+	e.POST("/boom").Expect().Status(503).Text().Equal("handled: secret details")
+	e.GET("/before").Expect().Status(503).Text().Equal("handled: before")
+	e.GET("/after").Expect().Status(503).Text().Equal("handled: after")
+	e.GET("/after/own").Expect().Status(400).Text().Equal("own: own")
+}
+
+func TestMuxNamedCatchAll(t *testing.T) {
+	r := NewRouter()
+	r.Get("/files/*path", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("file:" + URLParam(ctx, "path"))
+	})
+	r.Get("/repos/{repo:*2}", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("repo:" + URLParam(ctx, "repo"))
+	})
+	r.Route("/users/{id}", func(r Router) {
+		r.Get("/*rest", func(ctx *fasthttp.RequestCtx) {
+			ctx.WriteString("user:" + URLParam(ctx, "id") + ":" + URLParam(ctx, "rest"))
+		})
+	})
+
+	e := newFastHTTPTester(t, r)
+	e.GET("/files/css/site.css").Expect().Status(200).Text().Equal("file:css/site.css")
+	e.GET("/files/").Expect().Status(200).Text().Equal("file:")
+	e.GET("/repos/acme/phi").Expect().Status(200).Text().Equal("repo:acme/phi")
+	e.GET("/repos/acme").Expect().Status(404)
+	e.GET("/users/1/a/b").Expect().Status(200).Text().Equal("user:1:a/b")
+}
+
+func TestMuxMatch(t *testing.T) {
+	r := NewRouter()
+	r.Get("/", func(ctx *fasthttp.RequestCtx) {})
+	r.Route("/users", func(r Router) {
+		r.Get("/", func(ctx *fasthttp.RequestCtx) {})
+		r.Put("/{id}", func(ctx *fasthttp.RequestCtx) {})
+	})
+
+	tests := []struct {
+		method, path string
+		match        bool
+	}{
+		{"GET", "/", true},
+		{"POST", "/", false},
+		{"GET", "/users", true},
+		{"PUT", "/users", false},
+		{"GET", "/users/", false},
+		{"PUT", "/users/1", true},
+		{"GET", "/users/1", false},
+		{"GET", "/nowhere", false},
+	}
+	for _, tt := range tests {
+		if match := r.Match(NewRouteContext(), tt.method, tt.path); match != tt.match {
+			t.Errorf("%s %s: expecting match %v", tt.method, tt.path, tt.match)
+		}
+	}
+}
+
+func TestMuxMeta(t *testing.T) {
+	r := NewRouter()
+	r.Get("/", func(ctx *fasthttp.RequestCtx) {})
+	r.With(func(next RequestHandlerFunc) RequestHandlerFunc { return next }).
+		Post("/items", func(ctx *fasthttp.RequestCtx) {}, Meta("summary", "new item"), Meta("auth", true))
+	r.Handle("/any", func(ctx *fasthttp.RequestCtx) {}, Meta("summary", "anything"))
+	r.Get("/files/{name?}", func(ctx *fasthttp.RequestCtx) {}, Meta("summary", "files"))
+
+	meta := map[string]map[string]RouteMeta{}
+	for _, rt := range r.Routes() {
+		meta[rt.Pattern] = rt.Meta
+	}
+	if meta["/"] != nil {
+		t.Errorf("expecting no metadata, got:%v", meta["/"])
+	}
+	if m := meta["/items"]["POST"]; m["summary"] != "new item" || m["auth"] != true {
+		t.Errorf("expecting the metadata of the route, got:%v", meta["/items"])
+	}
+	if meta["/any"]["*"]["summary"] != "anything" || meta["/any"]["GET"]["summary"] != "anything" {
+		t.Errorf("expecting the metadata of all methods, got:%v", meta["/any"])
+	}
+	if meta["/files/{name?}"]["GET"]["summary"] != "files" {
+		t.Errorf("expecting the metadata of the optional route, got:%v", meta)
+	}
+
+	// re-registering a route replaces its metadata
+	r.Post("/items", func(ctx *fasthttp.RequestCtx) {})
+	for _, rt := range r.Routes() {
+		if rt.Pattern == "/items" && rt.Meta != nil {
+			t.Errorf("expecting the metadata to be replaced, got:%v", rt.Meta)
+		}
+	}
+}
+
+func TestMuxHost(t *testing.T) {
+	r := NewRouter()
+	r.NotFound(func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("not found")
+		ctx.SetStatusCode(404)
+	})
+	r.Get("/", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("default")
+	})
+	r.Host("{tenant:[a-z]+}.api.example.com", func(r Router) {
+		r.Get("/users/{id}", func(ctx *fasthttp.RequestCtx) {
+			ctx.WriteString("tenant " + URLParam(ctx, "tenant") + " user " + URLParam(ctx, "id"))
+		})
+	})
+	r.Host("{sub}.example.com", func(r Router) {
+		r.Use(func(next RequestHandlerFunc) RequestHandlerFunc {
+			return func(ctx *fasthttp.RequestCtx) {
+				next(ctx)
+				ctx.WriteString("+sub")
+			}
+		})
+		r.Get("/", func(ctx *fasthttp.RequestCtx) {
+			ctx.WriteString("sub " + URLParam(ctx, "sub"))
+		})
+	})
+	r.Host("www.example.com", func(r Router) {
+		r.Get("/", func(ctx *fasthttp.RequestCtx) {
+			ctx.WriteString("www")
+		})
+	})
+
+	tests := []struct {
+		host   string
+		path   string
+		status int
+		body   string
+	}{
+		{host: "example.com", path: "/", status: 200, body: "default"},
+		{host: "www.example.com", path: "/", status: 200, body: "www"},
+		{host: "WWW.Example.com:8080", path: "/", status: 200, body: "www"},
+		{host: "blog.example.com", path: "/", status: 200, body: "sub blog+sub"},
+		{host: "blog.example.com", path: "/nothing", status: 404, body: "not found+sub"},
+		{host: "a.b.example.com", path: "/", status: 200, body: "default"},
+		{host: "acme.api.example.com", path: "/users/42", status: 200, body: "tenant acme user 42"},
+		{host: "acme1.api.example.com", path: "/users/42", status: 404, body: "not found"},
+	}
+
+	for i, tt := range tests {
+		ctx := newRequestCtx("GET", tt.host, tt.path)
+		r.Handler(ctx)
+		if ctx.Response.StatusCode() != tt.status || string(ctx.Response.Body()) != tt.body {
+			t.Errorf("input [%d]: %s%s expecting %d %q, got %d %q", i, tt.host, tt.path,
+				tt.status, tt.body, ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+	}
+
+	if recv := catchPanic(func() { r.Host("{sub}.example.com", func(r Router) {}) }); recv == nil {
+		t.Error("registering an existing host pattern did not panic")
+	}
+	if recv := catchPanic(func() { r.Host("*.example.com", func(r Router) {}) }); recv == nil {
+		t.Error("registering a wildcard host pattern did not panic")
+	}
+}
+
+func TestMuxRedirect(t *testing.T) {
+	h := func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("ok")
+	}
+
+	r := NewRouter()
+	r.RedirectTrailingSlash = true
+	r.RedirectFixedPath = true
+	r.Get("/path", h)
+	r.Head("/path", h)
+	r.Get("/dir/", h)
+	r.Post("/post", h)
+	r.Get("/users/{id:[0-9]+}/Profile", h)
+	r.Route("/admin", func(r Router) {
+		r.Get("/Users", h)
+	})
+
+	off := NewRouter()
+	off.Get("/path", h)
+
+	tests := []struct {
+		mux      *Mux
+		method   string
+		path     string
+		status   int
+		location string
+	}{
+		{mux: r, method: "GET", path: "/path", status: 200},
+		{mux: r, method: "GET", path: "/path/", status: 301, location: "/path"},
+		{mux: r, method: "HEAD", path: "/path/", status: 301, location: "/path"},
+		{mux: r, method: "GET", path: "/dir", status: 301, location: "/dir/"},
+		{mux: r, method: "POST", path: "/post/", status: 308, location: "/post"},
+		{mux: r, method: "GET", path: "/post/", status: 404},
+		{mux: r, method: "GET", path: "/PATH", status: 301, location: "/path"},
+		{mux: r, method: "GET", path: "/PATH/", status: 301, location: "/path"},
+		{mux: r, method: "GET", path: "/../path/", status: 301, location: "/path"},
+		{mux: r, method: "GET", path: "/path?q=1/", status: 200},
+		{mux: r, method: "GET", path: "/path/?q=1", status: 301, location: "/path?q=1"},
+		{mux: r, method: "GET", path: "/USERS/42/profile", status: 301, location: "/users/42/Profile"},
+		{mux: r, method: "GET", path: "/users/abc/profile", status: 404},
+		{mux: r, method: "GET", path: "/admin/Users/", status: 301, location: "/admin/Users"},
+		{mux: r, method: "GET", path: "/ADMIN/users", status: 301, location: "/admin/Users"},
+		{mux: r, method: "GET", path: "/nothing", status: 404},
+		{mux: off, method: "GET", path: "/path/", status: 404},
+		{mux: off, method: "GET", path: "/PATH", status: 404},
+	}
+
+	for i, tt := range tests {
+		ctx := newRequestCtx(tt.method, "example.com", tt.path)
+		tt.mux.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != tt.status {
+			t.Errorf("input [%d]: %s %s expecting status %d, got %d", i, tt.method, tt.path, tt.status, status)
+		}
+		if tt.location == "" {
+			continue
+		}
+		if location := string(ctx.Response.Header.Peek("Location")); location != "http://example.com"+tt.location {
+			t.Errorf("input [%d]: %s %s expecting location %s, got %s", i, tt.method, tt.path, tt.location, location)
+		}
+	}
+}
+
+func TestMuxHandleOPTIONS(t *testing.T) {
+	h := func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("ok")
+	}
+
+	r := NewRouter()
+	r.HandleOPTIONS = true
+	r.Get("/", h)
+	r.Post("/", h)
+	r.Options("/custom", h)
+	r.Route("/sub", func(r Router) {
+		r.Delete("/{id}", h)
+	})
+
+	e := newFastHTTPTester(t, r)
+	e.OPTIONS("/").Expect().Status(204).Header("Allow").Equal("GET, POST, OPTIONS")
+	e.PUT("/").Expect().Status(405).Header("Allow").Equal("GET, POST, OPTIONS")
+	e.OPTIONS("/custom").Expect().Status(200).Text().Equal("ok")
+	e.OPTIONS("/sub/1").Expect().Status(204).Header("Allow").Equal("DELETE, OPTIONS")
+	e.OPTIONS("/nothing").Expect().Status(404)
+
+	off := NewRouter()
+	off.Get("/", h)
+	newFastHTTPTester(t, off).OPTIONS("/").Expect().Status(405).Header("Allow").Equal("GET")
+}
+
+func TestMuxHandleHEAD(t *testing.T) {
+	r := NewRouter()
+	r.HandleHEAD = true
+	r.Get("/", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("get")
+	})
+	r.Head("/head", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(204)
+	})
+	r.Get("/head", func(ctx *fasthttp.RequestCtx) {
+		ctx.WriteString("get")
+	})
+	r.Post("/post", func(ctx *fasthttp.RequestCtx) {})
+	r.Route("/sub", func(r Router) {
+		r.Get("/{id}", func(ctx *fasthttp.RequestCtx) {
+			ctx.WriteString("sub " + URLParam(ctx, "id"))
+		})
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		skip   bool
+	}{
+		{path: "/", status: 200, skip: true},
+		{path: "/head", status: 204, skip: false},
+		{path: "/sub/1", status: 200, skip: true},
+		{path: "/post", status: 405, skip: false},
+	}
+	for i, tt := range tests {
+		ctx := newRequestCtx("HEAD", "example.com", tt.path)
+		r.Handler(ctx)
+		if ctx.Response.StatusCode() != tt.status || ctx.Response.SkipBody != tt.skip {
+			t.Errorf("input [%d]: HEAD %s expecting %d skip:%v, got %d skip:%v", i, tt.path,
+				tt.status, tt.skip, ctx.Response.StatusCode(), ctx.Response.SkipBody)
+		}
+	}
+
+	e := newFastHTTPTester(t, r)
+	e.PUT("/").Expect().Status(405).Header("Allow").Equal("GET, HEAD")
+
+	methods := map[string]bool{}
+	Walk(r, func(method string, route string, handler HandlerFunc, middlewares ...Middleware) error {
+		methods[method+" "+route] = true
+		return nil
+	})
+	for _, route := range []string{"HEAD /", "HEAD /head", "HEAD /sub/*/{id}"} {
+		if !methods[route] {
+			t.Errorf("walk expecting route %s", route)
+		}
+	}
+	if methods["HEAD /post"] {
+		t.Errorf("walk unexpected route HEAD /post")
+	}
+}
+
+func TestMuxAllowedMethods(t *testing.T) {
+	h := func(ctx *fasthttp.RequestCtx) {}
+	r := NewRouter()
+	r.HandleHEAD = true
+	r.HandleOPTIONS = true
+	r.Post("/items", h)
+	r.Route("/users", func(r Router) {
+		r.Get("/{id}", h)
+		r.Put("/{id}", h)
+	})
+
+	// a mounted sub-router without the settings of the parent
+	api := NewRouter()
+	api.Post("/users", h)
+	api.Get("/users/{id}", h)
+	r.Mount("/api", api)
+
+	tests := []struct {
+		path    string
+		allowed string
+	}{
+		{"/items", "POST, OPTIONS"},
+		{"/users/1", "GET, HEAD, PUT, OPTIONS"},
+		{"/api/users", "POST"},
+		{"/api/users/1", "GET"},
+		{"/nowhere", ""},
+	}
+	for _, tt := range tests {
+		if allowed := strings.Join(r.AllowedMethods(tt.path), ", "); allowed != tt.allowed {
+			t.Errorf("%s: expecting %q, got:%q", tt.path, tt.allowed, allowed)
+		}
+
+		// the same methods as in the Allow header, for unknown methods too
+		for _, method := range []string{"DELETE", "FOO"} {
+			ctx := newRequestCtx(method, "example.com", tt.path)
+			r.Handler(ctx)
+			if allow := string(ctx.Response.Header.Peek("Allow")); allow != tt.allowed {
+				t.Errorf("%s %s: expecting Allow %q, got:%q", method, tt.path, tt.allowed, allow)
+			}
+			if tt.allowed != "" && ctx.Response.StatusCode() != 405 {
+				t.Errorf("%s %s: expecting 405, got:%d", method, tt.path, ctx.Response.StatusCode())
+			}
+		}
+	}
+}
+
 /*----------  Internal  ----------*/
 
 func bigMux() Router {
@@ -420,6 +1274,14 @@ func newFastHTTPTester(t *testing.T, h HandlerFunc) *httpexpect.Expect {
 	})
 }
 
+func newRequestCtx(method, host, path string) *fasthttp.RequestCtx {
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.Header.SetMethod(method)
+	ctx.Request.Header.SetHost(host)
+	ctx.Request.SetRequestURI(path)
+	return ctx
+}
+
 // Copyright 2013 Julien Schmidt. All rights reserved.
 // Use of this source code is governed by a BSD-style license that can be found
 // in the LICENSE file.
@@ -1339,10 +2201,23 @@ func BenchmarkRouterGet(b *testing.B) {
 // 	}
 // }
 
+func BenchmarkRouterStrict(b *testing.B) {
+	h := func(ctx *fasthttp.RequestCtx) {}
+	for i := 0; i < b.N; i++ {
+		r := NewRouter()
+		r.Strict = true
+		for j := 0; j < 1000; j++ {
+			r.Get(fmt.Sprintf("/r%d/{id}/items/{item:int}", j), h)
+		}
+	}
+}
+
 func BenchmarkRouterCleanPath(b *testing.B) {
 	resp := []byte("Bench GET")
 
 	r := New()
+	r.RedirectTrailingSlash = true
+	r.RedirectFixedPath = true
 	r.Get("/bench", func(ctx *fasthttp.RequestCtx) {
 		ctx.Success("text/plain", resp)
 	})
@@ -1360,6 +2235,7 @@ func BenchmarkRouterRedirectTrailingSlash(b *testing.B) {
 	resp := []byte("Bench GET")
 
 	r := New()
+	r.RedirectTrailingSlash = true
 	r.Get("/bench/", func(ctx *fasthttp.RequestCtx) {
 		ctx.Success("text/plain", resp)
 	})
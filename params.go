@@ -0,0 +1,147 @@
+package phi
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamMatcher reports whether a route param value is valid for a param type.
+type ParamMatcher func(value string) bool
+
+// paramTypes is the registry of named param types usable in routing patterns
+// as `{key:type}`, e.g. `{id:int}`.
+var paramTypes = map[string]ParamMatcher{
+	"int":   isInt,
+	"uint":  isUint,
+	"alpha": isAlpha,
+	"uuid":  isUUID,
+	"date":  isDate,
+}
+
+// RegisterParamType registers a named param type which can be used in routing
+// patterns as `{key:name}`. Values of params with a registered type are checked
+// by the `match` function instead of a regexp. Like RegisterMethod, it should be
+// called before any routes are defined.
+func RegisterParamType(name string, match ParamMatcher) {
+	if name == "" || match == nil {
+		panic("phi: param type must have a name and a matcher")
+	}
+	if name[0] == '^' || name[len(name)-1] == '$' {
+		panic(fmt.Sprintf("phi: param type '%s' must not look like a regexp", name))
+	}
+	paramTypes[name] = match
+}
+
+// paramMatcher returns the matcher for the type or regexp pattern of a param,
+// as returned by patNextSegment.
+func paramMatcher(rexpat string) (ParamMatcher, *regexp.Regexp, error) {
+	if match, ok := paramTypes[rexpat]; ok {
+		return match, nil, nil
+	}
+	rex, err := regexp.Compile(rexpat)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rex.MatchString, rex, nil
+}
+
+// catchAllMatcher returns the matcher of a catch-all constraint, as in
+// `{key:*}` or `{key:*N}`. Unlike a bare `*` wildcard, which also matches an
+// empty remainder, a constrained catch-all requires at least N non-empty path
+// segments, one if N is left out.
+func catchAllMatcher(spec string) (ParamMatcher, error) {
+	min := 1
+	if len(spec) > 1 {
+		n, err := strconv.Atoi(spec[1:])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("phi: invalid wildcard constraint '%s'", spec)
+		}
+		min = n
+	}
+	return func(value string) bool {
+		return countSegments(value, min) >= min
+	}, nil
+}
+
+// countSegments counts the non-empty segments of a path, up to `max`.
+func countSegments(path string, max int) int {
+	n := 0
+	for n < max && path != "" {
+		i := strings.IndexByte(path, '/')
+		if i < 0 {
+			return n + 1
+		}
+		if i > 0 {
+			n++
+		}
+		path = path[i+1:]
+	}
+	return n
+}
+
+func isInt(s string) bool {
+	if len(s) > 1 && s[0] == '-' {
+		s = s[1:]
+	}
+	return isUint(s)
+}
+
+func isUint(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlpha(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i] | 0x20; c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// isUUID matches the canonical 8-4-4-4-12 hex form of a UUID.
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHex(s[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isDate matches a YYYY-MM-DD calendar date.
+func isDate(s string) bool {
+	if len(s) != 10 {
+		return false
+	}
+	_, err := time.Parse("2006-01-02", s)
+	return err == nil
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c|0x20 >= 'a' && c|0x20 <= 'f')
+}
@@ -0,0 +1,23 @@
+package phi
+
+import (
+	"path"
+)
+
+// CleanPath is the URL version of path.Clean, it returns a canonical URL path
+// for p, eliminating . and .. elements and repeated slashes. A trailing slash
+// is preserved, and the returned path always begins with a slash.
+func CleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+
+	cp := path.Clean(p)
+	if p[len(p)-1] == '/' && cp != "/" {
+		cp += "/"
+	}
+	return cp
+}
@@ -135,9 +135,18 @@ func (fn RequestHandlerFunc) Handler(ctx *fasthttp.RequestCtx) {
 	fn(ctx)
 }
 
+// ErrorHandlerFunc is a handler returning an error, which is responded to
+// by the error handler of the Router it's registered on, see
+// Router.ErrorHandler.
+type ErrorHandlerFunc func(ctx *fasthttp.RequestCtx) error
+
 // Middleware represents phi middlewares, which accept a RequestHandlerFunc and return a RequestHandlerFunc
 type Middleware func(RequestHandlerFunc) RequestHandlerFunc
 
+// RouteOption configures an endpoint when it is registered on a Router,
+// e.g. r.Get("/users/{id}", h, phi.Name("user")).
+type RouteOption func(e *endpoint)
+
 // Middlewares type is a slice of standard middleware handlers with methods
 // to compose middleware chains and phi.HandlerFunc's.
 // type Middlewares []func(HandlerFunc) HandlerFunc
@@ -166,27 +175,40 @@ type Router interface {
 	// Route mounts a sub-Router along a `pattern`` string.
 	Route(pattern string, fn func(r Router))
 
+	// Host mounts a sub-Router serving the requests whose host
+	// matches the `pattern` string.
+	Host(pattern string, fn func(r Router))
+
 	// Mount attaches another phi.HandlerFunc along ./pattern/*
 	Mount(pattern string, h HandlerFunc)
 
 	// Handle and HandleFunc adds routes for `pattern` that matches
 	// all HTTP methods.
-	Handle(pattern string, h RequestHandlerFunc)
+	Handle(pattern string, h RequestHandlerFunc, opts ...RouteOption)
 
 	// Method and MethodFunc adds routes for `pattern` that matches
 	// the `method` HTTP method.
-	Method(method, pattern string, h RequestHandlerFunc)
+	Method(method, pattern string, h RequestHandlerFunc, opts ...RouteOption)
+
+	// HandleErr and MethodErr add routes like Handle and Method for
+	// handlers returning an error.
+	HandleErr(pattern string, h ErrorHandlerFunc, opts ...RouteOption)
+	MethodErr(method, pattern string, h ErrorHandlerFunc, opts ...RouteOption)
+
+	// Remove removes the route for `pattern` that matches the
+	// `method` HTTP method, or all methods for "*".
+	Remove(method, pattern string) bool
 
 	// HTTP-method routing along `pattern`
-	Connect(pattern string, h RequestHandlerFunc)
-	Delete(pattern string, h RequestHandlerFunc)
-	Get(pattern string, h RequestHandlerFunc)
-	Head(pattern string, h RequestHandlerFunc)
-	Options(pattern string, h RequestHandlerFunc)
-	Patch(pattern string, h RequestHandlerFunc)
-	Post(pattern string, h RequestHandlerFunc)
-	Put(pattern string, h RequestHandlerFunc)
-	Trace(pattern string, h RequestHandlerFunc)
+	Connect(pattern string, h RequestHandlerFunc, opts ...RouteOption)
+	Delete(pattern string, h RequestHandlerFunc, opts ...RouteOption)
+	Get(pattern string, h RequestHandlerFunc, opts ...RouteOption)
+	Head(pattern string, h RequestHandlerFunc, opts ...RouteOption)
+	Options(pattern string, h RequestHandlerFunc, opts ...RouteOption)
+	Patch(pattern string, h RequestHandlerFunc, opts ...RouteOption)
+	Post(pattern string, h RequestHandlerFunc, opts ...RouteOption)
+	Put(pattern string, h RequestHandlerFunc, opts ...RouteOption)
+	Trace(pattern string, h RequestHandlerFunc, opts ...RouteOption)
 
 	// NotFound defines a handler to respond whenever a route could
 	// not be found.
@@ -195,6 +217,10 @@ type Router interface {
 	// MethodNotAllowed defines a handler to respond whenever a method is
 	// not allowed.
 	MethodNotAllowed(h RequestHandlerFunc)
+
+	// ErrorHandler defines a handler to respond to the errors returned
+	// by ErrorHandlerFunc routes.
+	ErrorHandler(h func(ctx *fasthttp.RequestCtx, err error))
 }
 
 // Routes interface adds two methods for router traversal, which is also
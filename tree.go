@@ -87,6 +87,9 @@ type node struct {
 	// regexp matcher for regexp nodes
 	rex *regexp.Regexp
 
+	// value matcher for regexp and typed param nodes
+	match ParamMatcher
+
 	// HTTP handler endpoints on the leaf node
 	endpoints endpoints
 
@@ -96,6 +99,10 @@ type node struct {
 	// child nodes should be stored in-order for iteration,
 	// in groups of the node type.
 	children [ntCatchAll + 1]nodes
+
+	// index of the patterns of a root node for the conflict checks of
+	// the Strict mode, built on first use
+	conflicts *patternIndex
 }
 
 // endpoints is a mapping of http method constants to handlers
@@ -111,6 +118,22 @@ type endpoint struct {
 
 	// parameter keys recorded on handler nodes
 	paramKeys []string
+
+	// name is the optional route name used for reverse routing
+	name string
+
+	// default values of the optional params left out of the pattern
+	defaults RouteParams
+
+	// meta is the optional route metadata reported by Mux.Routes
+	meta RouteMeta
+
+	// patterns of the routes whose handler was replaced by this one
+	replaced []string
+
+	// updated reports whether the endpoint was registered by Mux.Update,
+	// replacing the handler of an earlier registration on purpose
+	updated bool
 }
 
 func (s endpoints) Value(method methodTyp) *endpoint {
@@ -122,7 +145,26 @@ func (s endpoints) Value(method methodTyp) *endpoint {
 	return mh
 }
 
-func (n *node) InsertRoute(method methodTyp, pattern string, handler HandlerFunc) *node {
+func (n *node) InsertRoute(method methodTyp, pattern string, handler HandlerFunc, opts ...RouteOption) *node {
+	routes := patExpandOptional(pattern)
+	if len(routes) == 1 {
+		return n.insertRoute(method, pattern, handler, opts...)
+	}
+
+	// Insert every expansion of a pattern with optional params, keeping the
+	// pattern as registered on the endpoints. The node of the complete
+	// pattern is returned.
+	var hn *node
+	for _, rt := range routes {
+		xopts := make([]RouteOption, len(opts), len(opts)+1)
+		copy(xopts, opts)
+		xopts = append(xopts, optionalRoute(pattern, rt.defaults))
+		hn = n.insertRoute(method, rt.pattern, handler, xopts...)
+	}
+	return hn
+}
+
+func (n *node) insertRoute(method methodTyp, pattern string, handler HandlerFunc, opts ...RouteOption) *node {
 	var parent *node
 	search := pattern
 
@@ -130,7 +172,7 @@ func (n *node) InsertRoute(method methodTyp, pattern string, handler HandlerFunc
 		// Handle key exhaustion
 		if len(search) == 0 {
 			// Insert or update the node's leaf handler
-			n.setEndpoint(method, handler, pattern)
+			n.setEndpoint(method, handler, pattern, opts...)
 			return n
 		}
 
@@ -146,9 +188,13 @@ func (n *node) InsertRoute(method methodTyp, pattern string, handler HandlerFunc
 		}
 
 		var prefix string
-		if segTyp == ntRegexp {
+		if segTyp == ntRegexp || segTyp == ntCatchAll {
 			prefix = segRexpat
 		}
+		if segTyp == ntCatchAll {
+			// catch-all nodes are labeled '*', whether declared as `*key` or `{key:*}`
+			label = '*'
+		}
 
 		// Look for the edge to attach to
 		parent = n
@@ -158,7 +204,7 @@ func (n *node) InsertRoute(method methodTyp, pattern string, handler HandlerFunc
 		if n == nil {
 			child := &node{label: label, tail: segTail, prefix: search}
 			hn := parent.addChild(child, search)
-			hn.setEndpoint(method, handler, pattern)
+			hn.setEndpoint(method, handler, pattern, opts...)
 
 			return hn
 		}
@@ -198,7 +244,7 @@ func (n *node) InsertRoute(method methodTyp, pattern string, handler HandlerFunc
 		// If the new key is a subset, set the method/handler on this node and finish.
 		search = search[commonPrefix:]
 		if len(search) == 0 {
-			child.setEndpoint(method, handler, pattern)
+			child.setEndpoint(method, handler, pattern, opts...)
 			return child
 		}
 
@@ -209,7 +255,7 @@ func (n *node) InsertRoute(method methodTyp, pattern string, handler HandlerFunc
 			prefix: search,
 		}
 		hn := child.addChild(subchild, search)
-		hn.setEndpoint(method, handler, pattern)
+		hn.setEndpoint(method, handler, pattern, opts...)
 		return hn
 	}
 }
@@ -239,12 +285,24 @@ func (n *node) addChild(child *node, prefix string) *node {
 		// Search prefix contains a param, regexp or wildcard
 
 		if segTyp == ntRegexp {
-			rex, err := regexp.Compile(segRexpat)
+			match, rex, err := paramMatcher(segRexpat)
 			if err != nil {
 				panic(fmt.Sprintf("phi: invalid regexp pattern '%s' in route param", segRexpat))
 			}
 			child.prefix = segRexpat
 			child.rex = rex
+			child.match = match
+		}
+		if segTyp == ntCatchAll && segStartIdx == 0 {
+			child.label = '*'
+			child.prefix = segRexpat
+			if segRexpat != "" {
+				match, err := catchAllMatcher(segRexpat)
+				if err != nil {
+					panic(fmt.Sprintf("phi: invalid wildcard constraint '%s' in route param", segRexpat))
+				}
+				child.match = match
+			}
 		}
 
 		if segStartIdx == 0 {
@@ -260,10 +318,13 @@ func (n *node) addChild(child *node, prefix string) *node {
 				segStartIdx = len(search)
 			}
 			child.tail = segTail // for params, we set the tail
+			if segTail == '{' {
+				panic(fmt.Sprintf("phi: adjacent params must be separated by static text in routing pattern '%s'", prefix))
+			}
 
 			if segStartIdx != len(search) {
 				// add static edge for the remaining part, split the end.
-				// its not possible to have adjacent param nodes, so its certainly
+				// adjacent param nodes are not allowed, so its certainly
 				// going to be a static node next.
 
 				search = search[segStartIdx:] // advance search position
@@ -283,6 +344,7 @@ func (n *node) addChild(child *node, prefix string) *node {
 			child.typ = ntStatic
 			child.prefix = search[:segStartIdx]
 			child.rex = nil
+			child.match = nil
 
 			// add the param edge node
 			search = search[segStartIdx:]
@@ -318,7 +380,7 @@ func (n *node) getEdge(ntyp nodeTyp, label, tail byte, prefix string) *node {
 	nds := n.children[ntyp]
 	for i := 0; i < len(nds); i++ {
 		if nds[i].label == label && nds[i].tail == tail {
-			if ntyp == ntRegexp && nds[i].prefix != prefix {
+			if (ntyp == ntRegexp || ntyp == ntCatchAll) && nds[i].prefix != prefix {
 				continue
 			}
 			return nds[i]
@@ -327,7 +389,7 @@ func (n *node) getEdge(ntyp nodeTyp, label, tail byte, prefix string) *node {
 	return nil
 }
 
-func (n *node) setEndpoint(method methodTyp, handler HandlerFunc, pattern string) {
+func (n *node) setEndpoint(method methodTyp, handler HandlerFunc, pattern string, opts ...RouteOption) {
 	// Set the handler for the method type on the node
 	if n.endpoints == nil {
 		n.endpoints = make(endpoints)
@@ -339,24 +401,60 @@ func (n *node) setEndpoint(method methodTyp, handler HandlerFunc, pattern string
 		n.endpoints.Value(mSTUB).handler = handler
 	}
 	if method&mALL == mALL {
-		h := n.endpoints.Value(mALL)
-		h.handler = handler
-		h.pattern = pattern
-		h.paramKeys = paramKeys
+		n.endpoints.Value(mALL).set(handler, pattern, paramKeys, opts)
 		for _, m := range methodMap {
-			h := n.endpoints.Value(m)
-			h.handler = handler
-			h.pattern = pattern
-			h.paramKeys = paramKeys
+			n.endpoints.Value(m).set(handler, pattern, paramKeys, opts)
 		}
 	} else {
-		h := n.endpoints.Value(method)
-		h.handler = handler
-		h.pattern = pattern
-		h.paramKeys = paramKeys
+		n.endpoints.Value(method).set(handler, pattern, paramKeys, opts)
+	}
+}
+
+// set sets the handler of the endpoint, recording the pattern of the
+// handler it replaces for Mux.Validate. The handlers replaced by an update
+// aren't recorded, and neither are those replaced before it.
+func (e *endpoint) set(handler HandlerFunc, pattern string, paramKeys []string, opts []RouteOption) {
+	var prev string
+	if e.handler != nil {
+		prev = e.pattern
+	}
+	e.handler = handler
+	e.pattern = pattern
+	e.paramKeys = paramKeys
+	e.applyOptions(opts)
+
+	switch {
+	case e.updated:
+		e.replaced = nil
+	case prev != "" && !stringsContain(e.replaced, prev):
+		e.replaced = append(e.replaced, prev)
+	}
+}
+
+func (e *endpoint) applyOptions(opts []RouteOption) {
+	e.name = ""
+	e.defaults = RouteParams{}
+	e.meta = nil
+	e.updated = false
+	for _, opt := range opts {
+		opt(e)
 	}
 }
 
+// updatedRoute marks the endpoints of a route registered by Mux.Update.
+func updatedRoute(e *endpoint) {
+	e.updated = true
+}
+
+func stringsContain(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
 func (n *node) FindRoute(rctx *Context, method methodTyp, path string) (*node, endpoints, HandlerFunc) {
 	// Reset the context routing pattern and params
 	rctx.routePattern = ""
@@ -369,6 +467,12 @@ func (n *node) FindRoute(rctx *Context, method methodTyp, path string) (*node, e
 		return nil, nil, nil
 	}
 
+	// Fill in the defaults of optional params left out of the route
+	if ep := rn.endpoints[method]; len(ep.defaults.Keys) > 0 {
+		rctx.routeParams.Keys = append(rctx.routeParams.Keys, ep.defaults.Keys...)
+		rctx.routeParams.Values = append(rctx.routeParams.Values, ep.defaults.Values...)
+	}
+
 	// Record the routing params in the request lifecycle
 	rctx.URLParams.Keys = append(rctx.URLParams.Keys, rctx.routeParams.Keys...)
 	rctx.URLParams.Values = append(rctx.URLParams.Values, rctx.routeParams.Values...)
@@ -382,112 +486,189 @@ func (n *node) FindRoute(rctx *Context, method methodTyp, path string) (*node, e
 	return rn, rn.endpoints, rn.endpoints[method].handler
 }
 
-// nolint: gocyclo
 // Recursive edge traversal by checking all nodeTyp groups along the way.
 // It's like searching through a multi-dimensional radix trie.
 func (n *node) findRoute(rctx *Context, method methodTyp, path string) *node {
-	nn := n
-	search := path
-
-	for t, nds := range nn.children {
+	for t, nds := range n.children {
 		ntyp := nodeTyp(t)
 		if len(nds) == 0 {
 			continue
 		}
 
-		var xn *node
-		xsearch := search
-
-		var label byte
-		if search != "" {
-			label = search[0]
-		}
-
 		switch ntyp {
 		case ntStatic:
-			xn = nds.findEdge(label)
-			if xn == nil || !strings.HasPrefix(xsearch, xn.prefix) {
+			if path == "" {
+				continue
+			}
+			xn := nds.findEdge(path[0])
+			if xn == nil || !strings.HasPrefix(path, xn.prefix) {
 				continue
 			}
-			xsearch = xsearch[len(xn.prefix):]
+			if fin := xn.findEndpoint(rctx, method, path[len(xn.prefix):]); fin != nil {
+				return fin
+			}
 
 		case ntParam, ntRegexp:
 			// short-circuit and return no matching route for empty param values
-			if xsearch == "" {
+			if path == "" {
 				continue
 			}
+			if fin := nds.findParam(rctx, method, path); fin != nil {
+				return fin
+			}
 
-			// serially loop through each node grouped by the tail delimiter
-			for idx := 0; idx < len(nds); idx++ {
-				xn = nds[idx]
-
-				// label for param nodes is the delimiter byte
-				p := strings.IndexByte(xsearch, xn.tail)
-
-				if p <= 0 {
-					if xn.tail == '/' {
-						p = len(xsearch)
-					} else {
-						continue
-					}
-				}
-
-				if ntyp == ntRegexp && xn.rex != nil {
-					if !xn.rex.Match([]byte(xsearch[:p])) {
-						continue
-					}
-				} else if strings.IndexByte(xsearch[:p], '/') != -1 {
-					// avoid a match across path segments
+		default:
+			// catch-all nodes, the constrained ones in order of registration
+			for _, xn := range nds {
+				if xn.match != nil && !xn.match(path) {
 					continue
 				}
-
-				rctx.routeParams.Values = append(rctx.routeParams.Values, xsearch[:p])
-				xsearch = xsearch[p:]
-				break
+				rctx.routeParams.Values = append(rctx.routeParams.Values, path)
+				if fin := xn.findEndpoint(rctx, method, ""); fin != nil {
+					return fin
+				}
+				rctx.routeParams.Values = rctx.routeParams.Values[:len(rctx.routeParams.Values)-1]
 			}
+		}
+	}
 
-		default:
-			// catch-all nodes
-			rctx.routeParams.Values = append(rctx.routeParams.Values, search)
-			xn = nds[0]
-			xsearch = ""
+	return nil
+}
+
+// findParam matches the param nodes of a group against the value at the start
+// of `path`. A value never spans path segments. Within a segment, the shortest
+// value is tried first, so params are delimited by the leftmost static text
+// which lets the rest of the route match, and the nodes sharing a delimiter
+// are tried in order of registration.
+func (ns nodes) findParam(rctx *Context, method methodTyp, path string) *node {
+	end := strings.IndexByte(path, '/')
+	if end < 0 {
+		end = len(path)
+	}
+
+	// Values can only end inside the segment when a param is followed by
+	// static text other than '/'
+	p := end
+	for _, xn := range ns {
+		if xn.tail != '/' {
+			p = 1
+			break
 		}
+	}
 
-		if xn == nil {
-			continue
+	for ; p <= end; p++ {
+		var tail byte = '/'
+		if p < end {
+			tail = path[p]
 		}
 
-		// did we find it yet?
-		if len(xsearch) == 0 {
-			if xn.isLeaf() {
-				h := xn.endpoints[method]
-				if h != nil && h.handler != nil {
-					rctx.routeParams.Keys = append(rctx.routeParams.Keys, h.paramKeys...)
-					return xn
-				}
+		for _, xn := range ns {
+			if xn.tail != tail {
+				continue
+			}
+			if xn.typ == ntRegexp && xn.match != nil && !xn.match(path[:p]) {
+				continue
+			}
 
-				// flag that the routing context found a route, but not a corresponding
-				// supported method
-				rctx.methodNotAllowed = true
+			rctx.routeParams.Values = append(rctx.routeParams.Values, path[:p])
+			if fin := xn.findEndpoint(rctx, method, path[p:]); fin != nil {
+				return fin
 			}
+			// Did not find final handler, let's remove the param here
+			rctx.routeParams.Values = rctx.routeParams.Values[:len(rctx.routeParams.Values)-1]
 		}
+	}
+
+	return nil
+}
 
-		// recursively find the next node..
-		fin := xn.findRoute(rctx, method, xsearch)
-		if fin != nil {
-			return fin
+// findEndpoint returns `n` if `search` is exhausted on a leaf with a `method`
+// handler, or keeps on looking for one below `n`.
+func (n *node) findEndpoint(rctx *Context, method methodTyp, search string) *node {
+	// did we find it yet?
+	if search == "" && n.isLeaf() {
+		h := n.endpoints[method]
+		if h != nil && h.handler != nil {
+			rctx.routeParams.Keys = append(rctx.routeParams.Keys, h.paramKeys...)
+			return n
 		}
 
-		// Did not find final handler, let's remove the param here if it was set
-		if xn.typ > ntStatic {
-			if len(rctx.routeParams.Values) > 0 {
-				rctx.routeParams.Values = rctx.routeParams.Values[:len(rctx.routeParams.Values)-1]
+		// flag that the routing context found a route, but not a corresponding
+		// supported method
+		rctx.methodNotAllowed = true
+		for mt, h := range n.endpoints {
+			if mt != mSTUB && mt != mALL && h.handler != nil {
+				rctx.allowedMethodTyps |= mt
 			}
 		}
-
 	}
 
-	return nil
+	// recursively find the next node..
+	return n.findRoute(rctx, method, search)
+}
+
+// findFixedPath makes a case-insensitive lookup of `path` for a route with a
+// `method` handler, descending into mounted sub-routers. On success it returns
+// `fixed` appended with the case-corrected path.
+func (n *node) findFixedPath(method methodTyp, path string, fixed []byte) ([]byte, bool) {
+	for t, nds := range n.children {
+		ntyp := nodeTyp(t)
+
+		for _, xn := range nds {
+			var xsearch string
+			xfixed := fixed
+
+			switch ntyp {
+			case ntStatic:
+				if len(path) < len(xn.prefix) || !strings.EqualFold(path[:len(xn.prefix)], xn.prefix) {
+					continue
+				}
+				xfixed = append(xfixed, xn.prefix...)
+				xsearch = path[len(xn.prefix):]
+
+			case ntParam, ntRegexp:
+				if path == "" {
+					continue
+				}
+				p := strings.IndexByte(path, xn.tail)
+				if p <= 0 {
+					if xn.tail != '/' {
+						continue
+					}
+					p = len(path)
+				}
+				if strings.IndexByte(path[:p], '/') != -1 {
+					continue
+				}
+				if ntyp == ntRegexp && xn.match != nil && !xn.match(path[:p]) {
+					continue
+				}
+				xfixed = append(xfixed, path[:p]...)
+				xsearch = path[p:]
+
+			default:
+				// catch-all nodes take the rest of the path, unless it's the mount
+				// point of a sub-router that can fix the rest itself
+				if subMux, ok := xn.subroutes.(*Mux); ok {
+					if sfixed, ok := subMux.root().findFixedPath(method, "/"+path, nil); ok {
+						return append(xfixed, sfixed[1:]...), true
+					}
+					continue
+				}
+				xfixed = append(xfixed, path...)
+			}
+
+			if xsearch == "" {
+				if h := xn.endpoints[method]; h != nil && h.handler != nil {
+					return xfixed, true
+				}
+			}
+			if fp, ok := xn.findFixedPath(method, xsearch, xfixed); ok {
+				return fp, true
+			}
+		}
+	}
+	return nil, false
 }
 
 func (n *node) findEdge(ntyp nodeTyp, label byte) *node {
@@ -518,6 +699,95 @@ func (n *node) findEdge(ntyp nodeTyp, label byte) *node {
 	}
 }
 
+// clone returns a deep copy of the tree, sharing the handlers, matchers and
+// mounted sub-routers of the nodes.
+func (n *node) clone() *node {
+	cn := *n
+	cn.conflicts = nil
+	if n.endpoints != nil {
+		cn.endpoints = make(endpoints, len(n.endpoints))
+		for mt, e := range n.endpoints {
+			ce := *e
+			ce.replaced = ce.replaced[:len(ce.replaced):len(ce.replaced)]
+			cn.endpoints[mt] = &ce
+		}
+	}
+	for typ, nds := range n.children {
+		if nds == nil {
+			continue
+		}
+		cn.children[typ] = make(nodes, len(nds))
+		for i, child := range nds {
+			cn.children[typ][i] = child.clone()
+		}
+	}
+	return &cn
+}
+
+// removeRoute removes the `method` endpoints registered with `pattern` from
+// the tree, pruning the nodes left without routes. With mSTUB in `method`,
+// only the stub routes registered by Mount are removed. It reports whether
+// any endpoint was removed.
+func (n *node) removeRoute(method methodTyp, pattern string) bool {
+	removed := false
+
+	if n.endpoints != nil && (method&mSTUB == 0 || n.endpoints[mSTUB] != nil) {
+		for mt, h := range n.endpoints {
+			if h.pattern != pattern || mt&method == 0 {
+				continue
+			}
+			delete(n.endpoints, mt)
+			removed = true
+		}
+		if removed {
+			// The route no longer handles all methods, or is gone
+			if h := n.endpoints[mALL]; h != nil && h.pattern == pattern {
+				delete(n.endpoints, mALL)
+			}
+			if !n.hasHandler() {
+				n.endpoints = nil
+				n.subroutes = nil
+			}
+		}
+	}
+
+	for typ, nds := range n.children {
+		for i := 0; i < len(nds); i++ {
+			if !nds[i].removeRoute(method, pattern) {
+				continue
+			}
+			removed = true
+			if nds[i].endpoints == nil && nds[i].isEmpty() {
+				nds = append(nds[:i], nds[i+1:]...)
+				i--
+			}
+		}
+		n.children[typ] = nds
+	}
+
+	return removed
+}
+
+// hasHandler reports whether the node has an endpoint handling a method.
+func (n *node) hasHandler() bool {
+	for mt, h := range n.endpoints {
+		if mt != mSTUB && h.handler != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmpty reports whether the node has no child nodes.
+func (n *node) isEmpty() bool {
+	for _, nds := range n.children {
+		if len(nds) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
 func (n *node) isLeaf() bool {
 	return n.endpoints != nil
 }
@@ -548,7 +818,7 @@ func (n *node) findPattern(pattern string) bool {
 			idx = strings.IndexByte(pattern, '}') + 1
 
 		case ntCatchAll:
-			idx = longestPrefix(pattern, "*")
+			idx = len(pattern)
 
 		default:
 			panic("phi: unknown node type")
@@ -568,6 +838,10 @@ func (n *node) findPattern(pattern string) bool {
 func (n *node) routes() []Route {
 	rts := []Route{}
 
+	// Patterns with optional params span several nodes, their
+	// handlers are merged into a single route.
+	patIdx := make(map[string]int)
+
 	n.walk(func(eps endpoints, subroutes Routes) bool {
 		if eps[mSTUB] != nil && eps[mSTUB].handler != nil && subroutes == nil {
 			return false
@@ -590,6 +864,7 @@ func (n *node) routes() []Route {
 
 		for p, mh := range pats {
 			hs := make(map[string]HandlerFunc)
+			var meta map[string]RouteMeta
 			if mh[mALL] != nil && mh[mALL].handler != nil {
 				hs["*"] = mh[mALL].handler
 			}
@@ -598,14 +873,41 @@ func (n *node) routes() []Route {
 				if h.handler == nil {
 					continue
 				}
-				m := methodTypString(mt)
-				if m == "" {
-					continue
+				m := "*"
+				if mt != mALL {
+					m = methodTypString(mt)
+					if m == "" {
+						continue
+					}
+					hs[m] = h.handler
+				}
+				if h.meta != nil {
+					if meta == nil {
+						meta = make(map[string]RouteMeta)
+					}
+					meta[m] = h.meta
+				}
+			}
+
+			if idx, ok := patIdx[p]; ok {
+				for m, h := range hs {
+					if _, ok := rts[idx].Handlers[m]; !ok {
+						rts[idx].Handlers[m] = h
+					}
 				}
-				hs[m] = h.handler
+				for m, md := range meta {
+					if rts[idx].Meta == nil {
+						rts[idx].Meta = make(map[string]RouteMeta)
+					}
+					if _, ok := rts[idx].Meta[m]; !ok {
+						rts[idx].Meta[m] = md
+					}
+				}
+				continue
 			}
 
-			rt := Route{p, hs, subroutes}
+			rt := Route{Pattern: p, Handlers: hs, SubRoutes: subroutes, Meta: meta}
+			patIdx[p] = len(rts)
 			rts = append(rts, rt)
 		}
 
@@ -686,7 +988,16 @@ func patNextSegment(pattern string) (nodeTyp, string, string, byte, int, int) {
 			key = key[:idx]
 		}
 
-		if len(rexpat) > 0 {
+		// A `{key:*}` param is a constrained catch-all, see catchAllMatcher
+		if len(rexpat) > 0 && rexpat[0] == '*' {
+			if pe != len(pattern) {
+				panic("phi: wildcard '*' must be the last pattern in a route, otherwise use a '{param}'")
+			}
+			return ntCatchAll, key, rexpat, 0, ps, pe
+		}
+
+		// Registered param types are matched by name, see RegisterParamType
+		if _, ok := paramTypes[rexpat]; !ok && len(rexpat) > 0 {
 			if rexpat[0] != '^' {
 				rexpat = "^" + rexpat
 			}
@@ -698,9 +1009,15 @@ func patNextSegment(pattern string) (nodeTyp, string, string, byte, int, int) {
 		return nt, key, rexpat, tail, ps, pe
 	}
 
-	// Wildcard pattern as finale
-	// TODO: should we panic if there is stuff after the * ???
-	return ntCatchAll, "*", "", 0, ws, len(pattern)
+	// Wildcard pattern as finale, named after the text following the '*'
+	key := pattern[ws+1:]
+	if strings.IndexByte(key, '/') >= 0 {
+		panic("phi: wildcard '*' must be the last pattern in a route, otherwise use a '{param}'")
+	}
+	if key == "" {
+		key = "*"
+	}
+	return ntCatchAll, key, "", 0, ws, len(pattern)
 }
 
 func patParamKeys(pattern string) []string {
@@ -711,6 +1028,7 @@ func patParamKeys(pattern string) []string {
 		if ptyp == ntStatic {
 			return paramKeys
 		}
+		paramKey, _, _, _ = patParamSpec(paramKey)
 		for i := 0; i < len(paramKeys); i++ {
 			if paramKeys[i] == paramKey {
 				panic(fmt.Sprintf("phi: routing pattern '%s' contains duplicate param key, '%s'", pattern, paramKey))
@@ -721,6 +1039,117 @@ func patParamKeys(pattern string) []string {
 	}
 }
 
+// patParamSpec parses the key of a param segment as returned by patNextSegment,
+// which is either `key`, `key?` for an optional param or `key?=default` for an
+// optional param with a default value.
+func patParamSpec(spec string) (key string, optional bool, def string, hasDef bool) {
+	idx := strings.IndexByte(spec, '?')
+	if idx < 0 {
+		return spec, false, "", false
+	}
+	key, def = spec[:idx], spec[idx+1:]
+	if def == "" {
+		return key, true, "", false
+	}
+	if def[0] != '=' {
+		panic(fmt.Sprintf("phi: invalid optional param '%s', expecting '%s?=default'", spec, key))
+	}
+	return key, true, def[1:], true
+}
+
+// expandedRoute is one of the routes a pattern with optional params expands to.
+type expandedRoute struct {
+	pattern  string
+	defaults RouteParams
+}
+
+// patExpandOptional expands a routing pattern with optional trailing params, e.g.
+// `/reports/{year?}/{month?=01}`, into the patterns without the optional params
+// from the shortest to the complete one, along with the default values of the
+// params each one leaves out. An optional param spans the path segment it's in,
+// or the static text since the previous param when sharing a segment.
+func patExpandOptional(pattern string) []expandedRoute {
+	var b strings.Builder
+	var cuts []int
+	var defaults RouteParams
+	var defaultIdx []int
+
+	search := pattern
+	for {
+		segTyp, spec, rexpat, _, ps, pe := patNextSegment(search)
+		if segTyp == ntStatic {
+			b.WriteString(search)
+			break
+		}
+		key, optional, def, hasDef := patParamSpec(spec)
+
+		if optional {
+			if segTyp == ntCatchAll {
+				panic(fmt.Sprintf("phi: wildcard '*' can't be optional in '%s'", pattern))
+			}
+			if hasDef && segTyp == ntRegexp {
+				if match, _, err := paramMatcher(rexpat); err == nil && !match(def) {
+					panic(fmt.Sprintf("phi: default value '%s' of param '%s' does not match '%s'", def, key, rexpat))
+				}
+			}
+			cuts = append(cuts, b.Len()+patOptionalCut(search[:ps]))
+			defaultIdx = append(defaultIdx, len(defaults.Keys))
+			if hasDef {
+				defaults.Add(key, def)
+			}
+		} else if len(cuts) > 0 {
+			panic(fmt.Sprintf("phi: param '%s' follows an optional param in '%s', optional params must be trailing", key, pattern))
+		}
+
+		if segTyp == ntCatchAll {
+			b.WriteString(search)
+			break
+		}
+
+		// Write the segment without the optional spec
+		b.WriteString(search[:ps])
+		b.WriteString("{")
+		b.WriteString(key)
+		b.WriteString(search[ps+1+len(spec) : pe])
+		search = search[pe:]
+	}
+
+	if len(cuts) == 0 {
+		return []expandedRoute{{pattern: pattern}}
+	}
+
+	full := b.String()
+	routes := make([]expandedRoute, 0, len(cuts)+1)
+	for i, cut := range cuts {
+		rt := expandedRoute{pattern: full[:cut]}
+		if rt.pattern == "" {
+			rt.pattern = "/"
+		}
+		rt.defaults.Keys = defaults.Keys[defaultIdx[i]:]
+		rt.defaults.Values = defaults.Values[defaultIdx[i]:]
+		routes = append(routes, rt)
+	}
+	return append(routes, expandedRoute{pattern: full})
+}
+
+// patOptionalCut returns the index at which an optional param segment starts
+// in the static text preceding the param.
+func patOptionalCut(static string) int {
+	if idx := strings.LastIndexByte(static, '/'); idx >= 0 {
+		return idx
+	}
+	return 0
+}
+
+// optionalRoute records the registered pattern and the defaults of the optional
+// params left out on the endpoints of an expanded route.
+func optionalRoute(pattern string, defaults RouteParams) RouteOption {
+	return func(e *endpoint) {
+		e.pattern = pattern
+		e.defaults = defaults
+	}
+}
+
 // longestPrefix finds the length of the shared prefix
 // of two strings
 func longestPrefix(k1, k2 string) int {
@@ -748,23 +1177,13 @@ func methodTypString(method methodTyp) string {
 
 type nodes []*node
 
-// Sort the list of nodes by label
-func (ns nodes) Sort()              { sort.Sort(ns); ns.tailSort() }
+// Sort the list of nodes by label, keeping the param nodes sharing the
+// same label in order of registration
+func (ns nodes) Sort()              { sort.Stable(ns) }
 func (ns nodes) Len() int           { return len(ns) }
 func (ns nodes) Swap(i, j int)      { ns[i], ns[j] = ns[j], ns[i] }
 func (ns nodes) Less(i, j int) bool { return ns[i].label < ns[j].label }
 
-// tailSort pushes nodes with '/' as the tail to the end of the list for param nodes.
-// The list order determines the traversal order.
-func (ns nodes) tailSort() {
-	for i := len(ns) - 1; i >= 0; i-- {
-		if ns[i].typ > ntStatic && ns[i].tail == '/' {
-			ns.Swap(i, len(ns)-1)
-			return
-		}
-	}
-}
-
 func (ns nodes) findEdge(label byte) *node {
 	num := len(ns)
 	idx := 0
@@ -790,6 +1209,10 @@ type Route struct {
 	Pattern   string
 	Handlers  map[string]HandlerFunc
 	SubRoutes Routes
+
+	// Meta is the metadata of the handlers set with the Meta route
+	// option, by method like Handlers.
+	Meta map[string]RouteMeta
 }
 
 // WalkFunc is the type of the function called for each method and route visited by Walk.
@@ -3,6 +3,7 @@ package phi
 import (
 	"fmt"
 	"log"
+	"strings"
 	"testing"
 
 	"github.com/valyala/fasthttp"
@@ -62,7 +63,7 @@ func TestTree(t *testing.T) {
 	tr.InsertRoute(mGET, "/admin/user/{id}", hUserShow)
 
 	tr.InsertRoute(mGET, "/admin/apps/{id}", hAdminAppShow)
-	tr.InsertRoute(mGET, "/admin/apps/{id}/*ff", hAdminAppShowCatchall) // TODO: ALLOWED...? prob not.. panic..?
+	tr.InsertRoute(mGET, "/admin/apps/{id}/*ff", hAdminAppShowCatchall) // named wildcard
 
 	tr.InsertRoute(mGET, "/admin/*ff", hStub) // catchall segment will get replaced by next route
 	tr.InsertRoute(mGET, "/admin/*", hAdminCatchall)
@@ -110,7 +111,7 @@ func TestTree(t *testing.T) {
 		{r: "/admin/hi", h: hAdminCatchall, k: []string{"*"}, v: []string{"hi"}},
 		{r: "/admin/lots/of/:fun", h: hAdminCatchall, k: []string{"*"}, v: []string{"lots/of/:fun"}},
 		{r: "/admin/apps/333", h: hAdminAppShow, k: []string{"id"}, v: []string{"333"}},
-		{r: "/admin/apps/333/woot", h: hAdminAppShowCatchall, k: []string{"id", "*"}, v: []string{"333", "woot"}},
+		{r: "/admin/apps/333/woot", h: hAdminAppShowCatchall, k: []string{"id", "ff"}, v: []string{"333", "woot"}},
 
 		{r: "/hubs/123/view", h: hHubView1, k: []string{"hubID"}, v: []string{"123"}},
 		{r: "/hubs/123/view/index.html", h: hHubView2, k: []string{"hubID", "*"}, v: []string{"123", "index.html"}},
@@ -334,6 +335,257 @@ func TestTreeRegexp(t *testing.T) {
 	}
 }
 
+func TestTreeParamTypes(t *testing.T) {
+	hInt := newStub()
+	hUUID := newStub()
+	hAlpha := newStub()
+	hDate := newStub()
+	hHex := newStub()
+	hSlug := newStub()
+
+	RegisterParamType("hex", func(value string) bool {
+		for i := 0; i < len(value); i++ {
+			if !isHex(value[i]) {
+				return false
+			}
+		}
+		return value != ""
+	})
+
+	tr := &node{}
+	tr.InsertRoute(mGET, "/items/{id:int}", hInt)
+	tr.InsertRoute(mGET, "/items/{id:uuid}", hUUID)
+	tr.InsertRoute(mGET, "/items/{name:alpha}", hAlpha)
+	tr.InsertRoute(mGET, "/items/{slug}", hSlug)
+	tr.InsertRoute(mGET, "/reports/{day:date}", hDate)
+	tr.InsertRoute(mGET, "/colors/{rgb:hex}", hHex)
+
+	tests := []struct {
+		r string      // input request path
+		h HandlerFunc // output matched handler
+		k []string    // output param keys
+		v []string    // output param values
+	}{
+		{r: "/items/42", h: hInt, k: []string{"id"}, v: []string{"42"}},
+		{r: "/items/-42", h: hInt, k: []string{"id"}, v: []string{"-42"}},
+		{r: "/items/6ba7b810-9dad-11d1-80b4-00c04fd430c8", h: hUUID, k: []string{"id"}, v: []string{"6ba7b810-9dad-11d1-80b4-00c04fd430c8"}},
+		{r: "/items/phi", h: hAlpha, k: []string{"name"}, v: []string{"phi"}},
+		{r: "/items/phi-42", h: hSlug, k: []string{"slug"}, v: []string{"phi-42"}},
+		{r: "/reports/2019-03-11", h: hDate, k: []string{"day"}, v: []string{"2019-03-11"}},
+		{r: "/reports/2019-13-11", h: nil, k: []string{}, v: []string{}},
+		{r: "/reports/2019-3-11", h: nil, k: []string{}, v: []string{}},
+		{r: "/reports/2020-02-29", h: hDate, k: []string{"day"}, v: []string{"2020-02-29"}},
+		{r: "/reports/2021-02-29", h: nil, k: []string{}, v: []string{}},
+		{r: "/reports/2021-02-31", h: nil, k: []string{}, v: []string{}},
+		{r: "/reports/2021-04-31", h: nil, k: []string{}, v: []string{}},
+		{r: "/colors/ff00AA", h: hHex, k: []string{"rgb"}, v: []string{"ff00AA"}},
+		{r: "/colors/red", h: nil, k: []string{}, v: []string{}},
+	}
+
+	for i, tt := range tests {
+		rctx := NewRouteContext()
+
+		_, handlers, _ := tr.FindRoute(rctx, mGET, tt.r)
+
+		var handler HandlerFunc
+		if methodHandler, ok := handlers[mGET]; ok {
+			handler = methodHandler.handler
+		}
+
+		paramKeys := rctx.routeParams.Keys
+		paramValues := rctx.routeParams.Values
+
+		if fmt.Sprintf("%v", tt.h) != fmt.Sprintf("%v", handler) {
+			t.Errorf("input [%d]: find '%s' expecting handler:%v , got:%v", i, tt.r, tt.h, handler)
+		}
+		if !stringSliceEqual(tt.k, paramKeys) {
+			t.Errorf("input [%d]: find '%s' expecting paramKeys:(%d)%v , got:(%d)%v", i, tt.r, len(tt.k), tt.k, len(paramKeys), paramKeys)
+		}
+		if !stringSliceEqual(tt.v, paramValues) {
+			t.Errorf("input [%d]: find '%s' expecting paramValues:(%d)%v , got:(%d)%v", i, tt.r, len(tt.v), tt.v, len(paramValues), paramValues)
+		}
+	}
+}
+
+func TestTreeOptionalParams(t *testing.T) {
+	hReports := newStub()
+	hFiles := newStub()
+	hPage := newStub()
+
+	tr := &node{}
+	tr.InsertRoute(mGET, "/reports/{year?=2019:int}/{month?}", hReports)
+	tr.InsertRoute(mGET, "/files/{name}.{ext?=txt}", hFiles)
+	tr.InsertRoute(mGET, "/{page?=home}", hPage)
+
+	tests := []struct {
+		r string      // input request path
+		h HandlerFunc // output matched handler
+		k []string    // output param keys
+		v []string    // output param values
+	}{
+		{r: "/reports", h: hReports, k: []string{"year"}, v: []string{"2019"}},
+		{r: "/reports/2020", h: hReports, k: []string{"year"}, v: []string{"2020"}},
+		{r: "/reports/2020/05", h: hReports, k: []string{"year", "month"}, v: []string{"2020", "05"}},
+		{r: "/reports/twenty", h: nil, k: []string{}, v: []string{}},
+		{r: "/files/notes", h: hFiles, k: []string{"name", "ext"}, v: []string{"notes", "txt"}},
+		{r: "/files/notes.md", h: hFiles, k: []string{"name", "ext"}, v: []string{"notes", "md"}},
+		{r: "/", h: hPage, k: []string{"page"}, v: []string{"home"}},
+		{r: "/about", h: hPage, k: []string{"page"}, v: []string{"about"}},
+	}
+
+	for i, tt := range tests {
+		rctx := NewRouteContext()
+
+		_, _, handler := tr.FindRoute(rctx, mGET, tt.r)
+
+		paramKeys := rctx.routeParams.Keys
+		paramValues := rctx.routeParams.Values
+
+		if fmt.Sprintf("%v", tt.h) != fmt.Sprintf("%v", handler) {
+			t.Errorf("input [%d]: find '%s' expecting handler:%v , got:%v", i, tt.r, tt.h, handler)
+		}
+		if !stringSliceEqual(tt.k, paramKeys) {
+			t.Errorf("input [%d]: find '%s' expecting paramKeys:(%d)%v , got:(%d)%v", i, tt.r, len(tt.k), tt.k, len(paramKeys), paramKeys)
+		}
+		if !stringSliceEqual(tt.v, paramValues) {
+			t.Errorf("input [%d]: find '%s' expecting paramValues:(%d)%v , got:(%d)%v", i, tt.r, len(tt.v), tt.v, len(paramValues), paramValues)
+		}
+		if handler != nil && !strings.Contains(rctx.routePattern, "?") {
+			t.Errorf("input [%d]: find '%s' expecting the registered route pattern, got:%s", i, tt.r, rctx.routePattern)
+		}
+	}
+
+	if rts := tr.routes(); len(rts) != 3 {
+		t.Errorf("expecting 3 routes, got:%d", len(rts))
+	}
+
+	for _, pattern := range []string{"/a/{x?}/{y}", "/a/{x?}/*", "/a/{x?=abc:int}", "/a/{x?abc}"} {
+		if recv := catchPanic(func() { (&node{}).InsertRoute(mGET, pattern, hPage) }); recv == nil {
+			t.Errorf("inserting invalid optional pattern '%s' did not panic", pattern)
+		}
+	}
+}
+
+func TestTreeSegmentParams(t *testing.T) {
+	hFile := newStub()
+	hArchive := newStub()
+	hDashed := newStub()
+	hName := newStub()
+	hVersion := newStub()
+	hDate := newStub()
+
+	tr := &node{}
+	tr.InsertRoute(mGET, "/files/{name}", hName)
+	tr.InsertRoute(mGET, "/files/{name}.{ext:[a-z]+}", hFile)
+	tr.InsertRoute(mGET, "/files/{name}.tar.{ext}", hArchive)
+	tr.InsertRoute(mGET, "/files/{name}-{rev:int}", hDashed)
+	tr.InsertRoute(mGET, "/v{major:uint}.{minor:uint}/status", hVersion)
+	tr.InsertRoute(mGET, "/log/{year}-{month}-{day}.txt", hDate)
+
+	tests := []struct {
+		r string      // input request path
+		h HandlerFunc // output matched handler
+		k []string    // output param keys
+		v []string    // output param values
+	}{
+		{r: "/files/notes", h: hName, k: []string{"name"}, v: []string{"notes"}},
+		{r: "/files/notes.md", h: hFile, k: []string{"name", "ext"}, v: []string{"notes", "md"}},
+		// the shortest name which lets the extension match
+		{r: "/files/my.notes.md", h: hFile, k: []string{"name", "ext"}, v: []string{"my.notes", "md"}},
+		{r: "/files/notes.md5", h: hName, k: []string{"name"}, v: []string{"notes.md5"}},
+		// static text takes precedence over a param at the same position
+		{r: "/files/src.tar.gz", h: hArchive, k: []string{"name", "ext"}, v: []string{"src", "gz"}},
+		{r: "/files/src.tar", h: hFile, k: []string{"name", "ext"}, v: []string{"src", "tar"}},
+		// the leftmost delimiter is tried first
+		{r: "/files/a-b.c", h: hFile, k: []string{"name", "ext"}, v: []string{"a-b", "c"}},
+		{r: "/files/a.b-2", h: hDashed, k: []string{"name", "rev"}, v: []string{"a.b", "2"}},
+		{r: "/files/a-b-2", h: hDashed, k: []string{"name", "rev"}, v: []string{"a-b", "2"}},
+		{r: "/files/.md", h: hName, k: []string{"name"}, v: []string{".md"}},
+		{r: "/v1.12/status", h: hVersion, k: []string{"major", "minor"}, v: []string{"1", "12"}},
+		{r: "/v1.x/status", h: nil, k: []string{}, v: []string{}},
+		{r: "/v1/status", h: nil, k: []string{}, v: []string{}},
+		{r: "/log/2019-05-01.txt", h: hDate, k: []string{"year", "month", "day"}, v: []string{"2019", "05", "01"}},
+		{r: "/log/2019-05.txt", h: nil, k: []string{}, v: []string{}},
+	}
+
+	for i, tt := range tests {
+		rctx := NewRouteContext()
+
+		_, _, handler := tr.FindRoute(rctx, mGET, tt.r)
+
+		paramKeys := rctx.routeParams.Keys
+		paramValues := rctx.routeParams.Values
+
+		if fmt.Sprintf("%v", tt.h) != fmt.Sprintf("%v", handler) {
+			t.Errorf("input [%d]: find '%s' expecting handler:%v , got:%v", i, tt.r, tt.h, handler)
+		}
+		if !stringSliceEqual(tt.k, paramKeys) {
+			t.Errorf("input [%d]: find '%s' expecting paramKeys:(%d)%v , got:(%d)%v", i, tt.r, len(tt.k), tt.k, len(paramKeys), paramKeys)
+		}
+		if !stringSliceEqual(tt.v, paramValues) {
+			t.Errorf("input [%d]: find '%s' expecting paramValues:(%d)%v , got:(%d)%v", i, tt.r, len(tt.v), tt.v, len(paramValues), paramValues)
+		}
+	}
+
+	if recv := catchPanic(func() { (&node{}).InsertRoute(mGET, "/{a}{b}", hName) }); recv == nil {
+		t.Errorf("inserting adjacent params did not panic")
+	}
+}
+
+func TestTreeCatchAllParams(t *testing.T) {
+	hFiles := newStub()
+	hRepo := newStub()
+	hDocs := newStub()
+	hDocsIndex := newStub()
+
+	tr := &node{}
+	tr.InsertRoute(mGET, "/files/*path", hFiles)
+	tr.InsertRoute(mGET, "/repos/{repo:*2}", hRepo)
+	tr.InsertRoute(mGET, "/docs/{page:*}", hDocs)
+	tr.InsertRoute(mGET, "/docs/*", hDocsIndex)
+
+	tests := []struct {
+		r string      // input request path
+		h HandlerFunc // output matched handler
+		k []string    // output param keys
+		v []string    // output param values
+	}{
+		{r: "/files/", h: hFiles, k: []string{"path"}, v: []string{""}},
+		{r: "/files/css/site.css", h: hFiles, k: []string{"path"}, v: []string{"css/site.css"}},
+		{r: "/repos/go/phi", h: hRepo, k: []string{"repo"}, v: []string{"go/phi"}},
+		{r: "/repos/go/phi/tree/master", h: hRepo, k: []string{"repo"}, v: []string{"go/phi/tree/master"}},
+		{r: "/repos/go", h: nil, k: []string{}, v: []string{}},
+		{r: "/repos/go/", h: nil, k: []string{}, v: []string{}},
+		{r: "/docs/intro", h: hDocs, k: []string{"page"}, v: []string{"intro"}},
+		{r: "/docs/", h: hDocsIndex, k: []string{"*"}, v: []string{""}},
+	}
+
+	for i, tt := range tests {
+		rctx := NewRouteContext()
+
+		_, _, handler := tr.FindRoute(rctx, mGET, tt.r)
+
+		paramKeys := rctx.routeParams.Keys
+		paramValues := rctx.routeParams.Values
+
+		if fmt.Sprintf("%v", tt.h) != fmt.Sprintf("%v", handler) {
+			t.Errorf("input [%d]: find '%s' expecting handler:%v , got:%v", i, tt.r, tt.h, handler)
+		}
+		if !stringSliceEqual(tt.k, paramKeys) {
+			t.Errorf("input [%d]: find '%s' expecting paramKeys:(%d)%v , got:(%d)%v", i, tt.r, len(tt.k), tt.k, len(paramKeys), paramKeys)
+		}
+		if !stringSliceEqual(tt.v, paramValues) {
+			t.Errorf("input [%d]: find '%s' expecting paramValues:(%d)%v , got:(%d)%v", i, tt.r, len(tt.v), tt.v, len(paramValues), paramValues)
+		}
+	}
+
+	for _, pattern := range []string{"/a/*/b", "/a/{rest:*}/b", "/a/{rest:*0}", "/a/{rest:*x}"} {
+		if recv := catchPanic(func() { (&node{}).InsertRoute(mGET, pattern, hFiles) }); recv == nil {
+			t.Errorf("inserting invalid wildcard pattern '%s' did not panic", pattern)
+		}
+	}
+}
+
 func TestTreeRegexMatchWholeParam(t *testing.T) {
 	hStub1 := newStub()
 
@@ -0,0 +1,162 @@
+package phi
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Name registers the route under `name` so its URL can be built later
+// with Mux.URL, instead of hard-coding the path in handlers and templates.
+func Name(name string) RouteOption {
+	return func(e *endpoint) {
+		e.name = name
+	}
+}
+
+// URL builds the path of the route registered under `name`, substituting
+// the pattern's `{param}`, `{param:regexp}` and wildcard segments with values
+// from `params`, a list of key/value pairs. Optional params may be left out,
+// along with the params following them, and all the given params must be used.
+// A wildcard is named after its key, `*` for a bare wildcard. Patterns of
+// mounted sub-routers are composed with the prefix they are mounted on.
+// Routes of host routers are searched last, and only their path is built.
+//
+// For example,
+//
+//  r.Get("/users/{id:[0-9]+}", h, phi.Name("user"))
+//  r.URL("user", "id", "42") // "/users/42"
+func (mx *Mux) URL(name string, params ...string) (string, error) {
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("phi: odd number of params when building url for route '%s'", name)
+	}
+
+	pattern, matchers, ok := mx.root().findNamed(name, nil)
+	hosts := mx.hostRoutes()
+	for i := 0; !ok && i < len(hosts); i++ {
+		pattern, matchers, ok = hosts[i].mux.root().findNamed(name, nil)
+	}
+	if !ok {
+		return "", fmt.Errorf("phi: no route named '%s'", name)
+	}
+
+	return buildURL(pattern, matchers, params)
+}
+
+// findNamed walks the tree for the endpoint registered under `name`. It returns
+// the endpoint pattern along with the value matchers of the regexp and typed
+// param nodes leading to it, descending into mounted sub-routers as it goes.
+func (n *node) findNamed(name string, matchers []ParamMatcher) (string, []ParamMatcher, bool) {
+	if n.typ == ntRegexp {
+		matchers = append(matchers, n.match)
+	}
+
+	for _, ep := range n.endpoints {
+		if ep.name == name && ep.pattern != "" {
+			return ep.pattern, matchers, true
+		}
+	}
+
+	if subMux, ok := n.subroutes.(*Mux); ok {
+		if pattern, subMatchers, ok := subMux.root().findNamed(name, nil); ok {
+			// The root of a sub-router is served on the bare mount prefix.
+			prefix := strings.TrimSuffix(n.endpoints[mALL].pattern, "/*")
+			if pattern == "/" && prefix != "" {
+				pattern = ""
+			}
+			return prefix + pattern, append(matchers, subMatchers...), true
+		}
+	}
+
+	for _, nds := range n.children {
+		for _, cn := range nds {
+			if pattern, found, ok := cn.findNamed(name, matchers); ok {
+				return pattern, found, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// buildURL substitutes the param segments of `pattern` with values from
+// `params`, validating regexp and typed params against `matchers`. It fails
+// on params left unused, like those following an omitted optional param.
+func buildURL(pattern string, matchers []ParamMatcher, params []string) (string, error) {
+	var b strings.Builder
+	var keys []string
+	search := pattern
+
+	for mi := 0; ; {
+		segTyp, spec, rexpat, _, ps, pe := patNextSegment(search)
+		if segTyp == ntStatic {
+			b.WriteString(search)
+			break
+		}
+		key, optional, _, _ := patParamSpec(spec)
+
+		value, ok := paramValue(params, key)
+		if !ok {
+			if !optional {
+				return "", fmt.Errorf("phi: missing param '%s' to build url for '%s'", key, pattern)
+			}
+			// Leave out the optional segments from here on
+			b.WriteString(search[:patOptionalCut(search[:ps])])
+			if b.Len() == 0 {
+				b.WriteByte('/')
+			}
+			break
+		}
+		keys = append(keys, key)
+		b.WriteString(search[:ps])
+
+		switch segTyp {
+		case ntCatchAll:
+			if rexpat != "" {
+				if match, err := catchAllMatcher(rexpat); err == nil && !match(value) {
+					return "", fmt.Errorf("phi: value '%s' for param '%s' does not match '%s'", value, key, rexpat)
+				}
+			}
+			segs := strings.Split(value, "/")
+			for i := range segs {
+				segs[i] = url.PathEscape(segs[i])
+			}
+			b.WriteString(strings.Join(segs, "/"))
+
+		default:
+			if value == "" || strings.IndexByte(value, '/') >= 0 {
+				return "", fmt.Errorf("phi: invalid value '%s' for param '%s' in '%s'", value, key, pattern)
+			}
+			if segTyp == ntRegexp {
+				var match ParamMatcher
+				if mi < len(matchers) {
+					match = matchers[mi]
+				} else {
+					match, _, _ = paramMatcher(rexpat)
+				}
+				mi++
+				if match != nil && !match(value) {
+					return "", fmt.Errorf("phi: value '%s' for param '%s' does not match '%s'", value, key, rexpat)
+				}
+			}
+			b.WriteString(url.PathEscape(value))
+		}
+
+		search = search[pe:]
+	}
+
+	for i := 0; i < len(params); i += 2 {
+		if !stringsContain(keys, params[i]) {
+			return "", fmt.Errorf("phi: unused param '%s' to build url for '%s'", params[i], pattern)
+		}
+	}
+	return b.String(), nil
+}
+
+func paramValue(params []string, key string) (string, bool) {
+	for i := 0; i+1 < len(params); i += 2 {
+		if params[i] == key {
+			return params[i+1], true
+		}
+	}
+	return "", false
+}